@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"event/components"
+	"event/components/adminapi"
+	"event/components/client"
+	"event/core/config"
+)
+
+const adminUsage = `usage: event admin [-addr host:port] [-config file] [-profile profile] [-token token] [-json] <command> [flags]
+
+commands:
+  conns      list connections, filter by -user -room -ip -path, at most -limit
+  conn       inspect a connection: conn <id>
+  kick       close connections: kick -id|-user|-room [-reason reason]
+  send       send to connections: send -id|-user|-room -event 0x0300 [-name name] [-param json]
+  broadcast  send to all connections: broadcast -event 0x0300 [-name name] [-param json]
+  stats      node stats
+  routes     route table and rate limits
+  config     running config, secrets redacted
+  reload     reload the config file
+  pprof      show pprof state: pprof [on|off]
+
+-addr defaults to admin.addr read from -config and -profile the same way the server reads it,
+so EVENT_ADMIN_ADDR overrides it, -token defaults to EVENT_ADMIN_TOKEN
+`
+
+var (
+	errUsage         = errors.New("bad usage")
+	errAdminDisabled = errors.New("admin api is disabled: admin.addr is empty, set it in the config or pass -addr")
+)
+
+// adminCli event admin子命令，输出表格或json，用法错误写入errOut
+type adminCli struct {
+	admin  *client.Admin
+	json   bool
+	out    io.Writer
+	errOut io.Writer
+}
+
+// runAdmin 返回进程退出码
+func runAdmin(args []string, out, errOut io.Writer) int {
+	var (
+		cli   = &adminCli{out: out, errOut: errOut}
+		flags = flag.NewFlagSet("admin", flag.ContinueOnError)
+		opt   config.Option
+		addr  string
+		token string
+	)
+
+	flags.SetOutput(errOut)
+	flags.Usage = func() {
+		fmt.Fprint(errOut, adminUsage)
+	}
+	flags.StringVar(&addr, "addr", "", "admin address, default admin.addr in the config")
+	flags.StringVar(&opt.File, "config", config.DefaultFile, "config file to read admin.addr from")
+	flags.StringVar(&opt.Profile, "profile", "", "config profile")
+	flags.StringVar(&token, "token", os.Getenv("EVENT_ADMIN_TOKEN"), "admin token")
+	flags.BoolVar(&cli.json, "json", false, "print json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if addr == "" {
+		var err error
+		if addr, err = adminAddr(opt); err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+	}
+
+	cli.admin = client.NewAdmin(addr, token)
+
+	err := cli.run(flags.Arg(0), flags.Args()[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		return 2
+	default:
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+}
+
+// adminAddr 与服务端相同的方式加载配置，包括profile和EVENT_*环境变量
+func adminAddr(opt config.Option) (string, error) {
+	result, err := components.LoadConfig(opt)
+	if err != nil {
+		return "", err
+	}
+
+	addr := result.Config.Params.String("admin.addr")
+	if addr == "" {
+		return "", errAdminDisabled
+	}
+	return addr, nil
+}
+
+func (ac *adminCli) run(command string, args []string) error {
+	switch command {
+	case "conns":
+		return ac.conns(args)
+	case "conn":
+		return ac.conn(args)
+	case "kick":
+		return ac.kick(args)
+	case "send":
+		return ac.send(args, false)
+	case "broadcast":
+		return ac.send(args, true)
+	case "stats":
+		return ac.stats()
+	case "routes":
+		return ac.routes()
+	case "config":
+		conf, err := ac.admin.Config()
+		if err != nil {
+			return err
+		}
+		return ac.print(conf)
+	case "reload":
+		return ac.reload()
+	case "pprof":
+		return ac.pprof(args)
+	}
+
+	fmt.Fprintf(ac.errOut, "unknown command %q\n\n%s", command, adminUsage)
+	return errUsage
+}
+
+func (ac *adminCli) commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("admin "+name, flag.ContinueOnError)
+	flags.SetOutput(ac.errOut)
+	return flags
+}
+
+// print 缩进输出json
+func (ac *adminCli) print(value interface{}) error {
+	encoder := json.NewEncoder(ac.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func (ac *adminCli) table(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(ac.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func ago(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return time.Since(t).Truncate(time.Second).String()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func (ac *adminCli) conns(args []string) error {
+	var (
+		query client.ConnQuery
+		flags = ac.commandFlags("conns")
+	)
+
+	flags.StringVar(&query.User, "user", "", "user id")
+	flags.StringVar(&query.Room, "room", "", "room")
+	flags.StringVar(&query.Ip, "ip", "", "client ip")
+	flags.StringVar(&query.Path, "path", "", "path prefix")
+	flags.IntVar(&query.Limit, "limit", 0, "max conns, server default 100")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	conns, err := ac.admin.Conns(query)
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(conns)
+	}
+
+	rows := make([][]string, 0, len(conns.Conns))
+	for _, conn := range conns.Conns {
+		rows = append(rows, []string{
+			strconv.FormatUint(conn.Id, 10),
+			orDash(conn.UserId),
+			orDash(strings.Join(conn.Rooms, ",")),
+			conn.ClientIp,
+			conn.Addr,
+			conn.Path,
+			strconv.Itoa(int(conn.Level)),
+			ago(conn.Created),
+			ago(conn.Active),
+		})
+	}
+
+	if err = ac.table([]string{"ID", "USER", "ROOMS", "CLIENT IP", "ADDR", "PATH", "LEVEL", "AGE", "IDLE"}, rows); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ac.out, "%d of %d conns\n", len(conns.Conns), conns.Total)
+	return nil
+}
+
+func (ac *adminCli) conn(args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintln(ac.errOut, "usage: event admin conn <id>")
+		return errUsage
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad conn id %s", args[0])
+	}
+
+	conn, err := ac.admin.Conn(id)
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(conn)
+	}
+
+	rows := [][]string{
+		{"id", strconv.FormatUint(conn.Id, 10)},
+		{"user", orDash(conn.UserId)},
+		{"rooms", orDash(strings.Join(conn.Rooms, ","))},
+		{"client ip", conn.ClientIp},
+		{"addr", conn.Addr},
+		{"path", conn.Path},
+		{"level", strconv.Itoa(int(conn.Level))},
+		{"created", conn.Created.Format(time.RFC3339)},
+		{"active", conn.Active.Format(time.RFC3339)},
+	}
+
+	names := make([]string, 0, len(conn.Headers))
+	for name := range conn.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rows = append(rows, []string{name, strings.Join(conn.Headers[name], ", ")})
+	}
+	return ac.table([]string{"FIELD", "VALUE"}, rows)
+}
+
+func (ac *adminCli) kick(args []string) error {
+	var (
+		kick  adminapi.Kick
+		flags = ac.commandFlags("kick")
+	)
+
+	flags.Uint64Var(&kick.Id, "id", 0, "conn id")
+	flags.StringVar(&kick.User, "user", "", "user id")
+	flags.StringVar(&kick.Room, "room", "", "room")
+	flags.StringVar(&kick.Reason, "reason", "", "reason sent to the client")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	kicked, err := ac.admin.Kick(kick)
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(map[string]int{"kicked": kicked})
+	}
+
+	fmt.Fprintf(ac.out, "kicked %d conns\n", kicked)
+	return nil
+}
+
+// send broadcast为true时发给全部连接，不接受-id、-user、-room
+func (ac *adminCli) send(args []string, broadcast bool) error {
+	var (
+		msg   adminapi.Message
+		param string
+		name  = "send"
+	)
+
+	if broadcast {
+		name = "broadcast"
+	}
+
+	flags := ac.commandFlags(name)
+	if !broadcast {
+		flags.Uint64Var(&msg.Id, "id", 0, "conn id")
+		flags.StringVar(&msg.User, "user", "", "user id")
+		flags.StringVar(&msg.Room, "room", "", "room")
+	}
+	flags.StringVar(&msg.Event, "event", "", "event id, 0x0300 or 768")
+	flags.StringVar(&msg.Name, "name", "", "package name")
+	flags.StringVar(&param, "param", "", "package param, json object")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if msg.Event == "" {
+		fmt.Fprintf(ac.errOut, "admin %s: -event is required\n", name)
+		return errUsage
+	}
+
+	if param != "" {
+		if err := json.Unmarshal([]byte(param), &msg.Param); err != nil {
+			return fmt.Errorf("bad param: %w", err)
+		}
+	}
+
+	if broadcast {
+		queued, err := ac.admin.Broadcast(msg)
+		if err != nil {
+			return err
+		}
+
+		if ac.json {
+			return ac.print(map[string]int64{"queued": queued})
+		}
+
+		fmt.Fprintf(ac.out, "broadcast queued for %d conns\n", queued)
+		return nil
+	}
+
+	sent, err := ac.admin.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(map[string]int{"sent": sent})
+	}
+
+	fmt.Fprintf(ac.out, "sent to %d conns\n", sent)
+	return nil
+}
+
+func (ac *adminCli) stats() error {
+	stats, err := ac.admin.Stats()
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(stats)
+	}
+
+	rows := [][]string{
+		{"name", stats.Name},
+		{"ver", stats.Ver},
+		{"env", stats.Env},
+		{"started", stats.Started.Format(time.RFC3339)},
+		{"uptime", (time.Duration(stats.Uptime) * time.Second).String()},
+		{"connections", strconv.FormatInt(stats.Connections, 10)},
+		{"goroutines", strconv.Itoa(stats.Goroutines)},
+		{"heap", fmt.Sprintf("%.1fMB", float64(stats.HeapAlloc)/(1<<20))},
+		{"gc", strconv.FormatUint(uint64(stats.NumGC), 10)},
+		{"pprof", strconv.FormatBool(stats.Pprof)},
+	}
+
+	reasons := make([]string, 0, len(stats.Rejections))
+	for reason := range stats.Rejections {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	for _, reason := range reasons {
+		rows = append(rows, []string{"rejected " + reason, strconv.FormatUint(stats.Rejections[reason], 10)})
+	}
+	return ac.table([]string{"STAT", "VALUE"}, rows)
+}
+
+func (ac *adminCli) routes() error {
+	routes, err := ac.admin.Routes()
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(routes)
+	}
+
+	rows := make([][]string, 0, len(routes.Routes))
+	for _, route := range routes.Routes {
+		limit := "-"
+		if route.Limit != nil {
+			limit = fmt.Sprintf("rate=%g burst=%d cost=%g", route.Limit.Rate, route.Limit.Burst, route.Limit.Cost)
+		}
+		rows = append(rows, []string{route.Event, strconv.Itoa(route.Handlers), limit})
+	}
+
+	if err = ac.table([]string{"EVENT", "HANDLERS", "LIMIT"}, rows); err != nil {
+		return err
+	}
+
+	if opt := routes.RateLimit; opt != nil {
+		fmt.Fprintf(ac.out, "rate limit: rate=%g burst=%d penalty=%s maxViolations=%d\n", opt.Rate, opt.Burst, opt.Penalty, opt.MaxViolations)
+	}
+	return nil
+}
+
+func (ac *adminCli) reload() error {
+	report, err := ac.admin.Reload()
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(report)
+	}
+
+	return ac.table([]string{"RESULT", "KEYS"}, [][]string{
+		{"applied", orDash(strings.Join(report.Applied, ","))},
+		{"restart", orDash(strings.Join(report.Restart, ","))},
+		{"failed", orDash(strings.Join(report.Failed, ","))},
+	})
+}
+
+func (ac *adminCli) pprof(args []string) error {
+	var (
+		state *adminapi.Pprof
+		err   error
+	)
+
+	switch {
+	case len(args) == 0:
+		state, err = ac.admin.Pprof()
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		state, err = ac.admin.SetPprof(args[0] == "on")
+	default:
+		fmt.Fprintln(ac.errOut, "usage: event admin pprof [on|off]")
+		return errUsage
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if ac.json {
+		return ac.print(state)
+	}
+
+	if state.Enable {
+		fmt.Fprintf(ac.out, "pprof on %s\n", state.Addr)
+		return nil
+	}
+
+	fmt.Fprintln(ac.out, "pprof off")
+	return nil
+}
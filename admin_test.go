@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"event/components/adminapi"
+)
+
+const testAdminToken = "t1"
+
+// fakeAdmin 只实现cli测试用到的接口，kicks记录收到的kick请求
+func fakeAdmin(t *testing.T, kicks *[]adminapi.Kick) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(adminapi.Stats{
+			Name:        "event",
+			Connections: 3,
+			Rejections:  map[string]uint64{"rate": 2},
+		})
+	})
+	mux.HandleFunc("/kick", func(w http.ResponseWriter, r *http.Request) {
+		var kick adminapi.Kick
+		if err := json.NewDecoder(r.Body).Decode(&kick); err != nil {
+			t.Errorf("decode kick: %v", err)
+		}
+		*kicks = append(*kicks, kick)
+		_ = json.NewEncoder(w).Encode(map[string]int{"kicked": 2})
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testAdminToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "bad token"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// unsetEnv 测试期间去掉会覆盖配置的环境变量
+func unsetEnv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		if value, exists := os.LookupEnv(key); exists {
+			_ = os.Unsetenv(key)
+			t.Cleanup(func() { _ = os.Setenv(key, value) })
+		}
+	}
+}
+
+func hasLine(out string, fields ...string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Join(strings.Fields(line), " ") == strings.Join(fields, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunAdmin(t *testing.T) {
+	var (
+		kicks []adminapi.Kick
+		srv   = fakeAdmin(t, &kicks)
+		addr  = strings.TrimPrefix(srv.URL, "http://")
+	)
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		out    []string
+		errOut string
+		lines  [][]string
+	}{
+		{name: "no command", args: []string{"-addr", addr}, code: 2, errOut: "usage: event admin"},
+		{name: "bad flag", args: []string{"-nope"}, code: 2, errOut: "flag provided but not defined"},
+		{name: "unknown command", args: []string{"-addr", addr, "-token", testAdminToken, "nope"}, code: 2, errOut: `unknown command "nope"`},
+		{name: "conn without id", args: []string{"-addr", addr, "conn"}, code: 2, errOut: "usage: event admin conn <id>"},
+		{name: "conn bad id", args: []string{"-addr", addr, "conn", "x"}, code: 1, errOut: "bad conn id x"},
+		{name: "send without event", args: []string{"-addr", addr, "send", "-room", "r1"}, code: 2, errOut: "-event is required"},
+		{name: "wrong token", args: []string{"-addr", addr, "-token", "t2", "stats"}, code: 1, errOut: "bad token (401)"},
+		{name: "no token", args: []string{"-addr", addr, "stats"}, code: 1, errOut: "bad token (401)"},
+		{
+			name:  "stats table",
+			args:  []string{"-addr", addr, "-token", testAdminToken, "stats"},
+			out:   []string{"STAT"},
+			lines: [][]string{{"name", "event"}, {"connections", "3"}, {"rejected", "rate", "2"}},
+		},
+		{
+			name: "stats json",
+			args: []string{"-addr", addr, "-token", testAdminToken, "-json", "stats"},
+			out:  []string{`"connections": 3`, `"rate": 2`},
+		},
+		{
+			name: "kick",
+			args: []string{"-addr", addr, "-token", testAdminToken, "kick", "-user", "u1", "-reason", "banned"},
+			out:  []string{"kicked 2 conns\n"},
+		},
+		{
+			name: "kick json",
+			args: []string{"-addr", "http://" + addr, "-token", testAdminToken, "-json", "kick", "-id", "7"},
+			out:  []string{`"kicked": 2`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			if code := runAdmin(tt.args, &out, &errOut); code != tt.code {
+				t.Fatalf("want code %d, got %d, stderr %q", tt.code, code, errOut.String())
+			}
+
+			for _, want := range tt.out {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("want stdout containing %q, got %q", want, out.String())
+				}
+			}
+
+			for _, line := range tt.lines {
+				if !hasLine(out.String(), line...) {
+					t.Fatalf("want line %q, got %q", strings.Join(line, " "), out.String())
+				}
+			}
+
+			if !strings.Contains(errOut.String(), tt.errOut) {
+				t.Fatalf("want stderr containing %q, got %q", tt.errOut, errOut.String())
+			}
+		})
+	}
+
+	want := []adminapi.Kick{{User: "u1", Reason: "banned"}, {Id: 7}}
+	if len(kicks) != len(want) {
+		t.Fatalf("want %d kicks, got %+v", len(want), kicks)
+	}
+
+	for i := range want {
+		if kicks[i] != want[i] {
+			t.Fatalf("want kick %+v, got %+v", want[i], kicks[i])
+		}
+	}
+}
+
+func TestRunAdmin_ConfigAddr(t *testing.T) {
+	unsetEnv(t, "EVENT_ADMIN_ADDR", "EVENT_PROFILE")
+
+	var (
+		kicks []adminapi.Kick
+		srv   = fakeAdmin(t, &kicks)
+		addr  = strings.TrimPrefix(srv.URL, "http://")
+		dir   = t.TempDir()
+		file  = filepath.Join(dir, "app.json")
+	)
+
+	// 以仓库里的配置为基础，admin.addr默认为空
+	data, err := ioutil.ReadFile("conf/app.json")
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if err = ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	profile := `{"params":{"admin.addr":"` + addr + `"}}`
+	if err = ioutil.WriteFile(filepath.Join(dir, "app.remote.json"), []byte(profile), 0644); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		env    string
+		args   []string
+		code   int
+		errOut string
+	}{
+		{name: "admin disabled", args: []string{"-config", file, "stats"}, code: 1, errOut: errAdminDisabled.Error()},
+		{name: "missing config", args: []string{"-config", filepath.Join(dir, "none.json"), "stats"}, code: 1, errOut: "none.json"},
+		{name: "missing profile", args: []string{"-config", file, "-profile", "none", "stats"}, code: 1, errOut: "app.none.json"},
+		{name: "profile", args: []string{"-config", file, "-profile", "remote", "-token", testAdminToken, "stats"}},
+		{name: "env", env: addr, args: []string{"-config", file, "-token", testAdminToken, "stats"}},
+		{name: "addr flag wins", args: []string{"-config", filepath.Join(dir, "none.json"), "-addr", addr, "-token", testAdminToken, "stats"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				_ = os.Setenv("EVENT_ADMIN_ADDR", tt.env)
+				defer os.Unsetenv("EVENT_ADMIN_ADDR")
+			}
+
+			var out, errOut bytes.Buffer
+			if code := runAdmin(tt.args, &out, &errOut); code != tt.code {
+				t.Fatalf("want code %d, got %d, stderr %q", tt.code, code, errOut.String())
+			}
+
+			if !strings.Contains(errOut.String(), tt.errOut) {
+				t.Fatalf("want stderr containing %q, got %q", tt.errOut, errOut.String())
+			}
+
+			if tt.code == 0 && !hasLine(out.String(), "connections", "3") {
+				t.Fatalf("want stats from the configured addr, got %q", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"strconv"
+	"text/template"
+
+	"github.com/grpc-boot/base"
+)
+
+type Event struct {
+	Name    string `json:"name"`
+	Id      string `json:"id"`
+	Comment string `json:"comment"`
+}
+
+type Group struct {
+	Comment string  `json:"comment"`
+	Events  []Event `json:"events"`
+}
+
+type Definition struct {
+	Groups []Group `json:"groups"`
+}
+
+const goTpl = `// Code generated by eventgen. DO NOT EDIT.
+
+package {{ .Pkg }}
+
+const (
+{{- range $index, $group := .Groups }}
+{{- if $index }}
+{{ end }}
+{{- if $group.Comment }}
+	// {{ $group.Comment }}
+{{- end }}
+{{- range $group.Events }}
+	{{ .Name }} = {{ .Id }}{{ if .Comment }} // {{ .Comment }}{{ end }}
+{{- end }}
+{{- end }}
+)
+`
+
+const jsTpl = `// Code generated by eventgen. DO NOT EDIT.
+{{ range .Groups }}
+{{- if .Comment }}
+// {{ .Comment }}
+{{- end }}
+{{- range .Events }}
+const {{ .Name }} = {{ .Id }};{{ if .Comment }} // {{ .Comment }}{{ end }}
+{{- end }}
+{{ end -}}
+`
+
+func main() {
+	var (
+		in     string
+		goOut  string
+		goPkg  string
+		jsOut  string
+		defini Definition
+	)
+
+	flag.StringVar(&in, "in", "events.json", "event definition file")
+	flag.StringVar(&goOut, "go", "", "go output file")
+	flag.StringVar(&goPkg, "pkg", "events", "go package name")
+	flag.StringVar(&jsOut, "js", "", "javascript output file")
+	flag.Parse()
+
+	if err := base.JsonDecodeFile(in, &defini); err != nil {
+		base.RedFatal("read definition file error:%s", err)
+	}
+
+	if err := defini.validate(); err != nil {
+		base.RedFatal("invalid definition file %s:%s", in, err)
+	}
+
+	if goOut != "" {
+		if err := defini.writeGo(goOut, goPkg); err != nil {
+			base.RedFatal("write go file error:%s", err)
+		}
+		base.Green("generated %s", goOut)
+	}
+
+	if jsOut != "" {
+		if err := defini.writeJs(jsOut); err != nil {
+			base.RedFatal("write js file error:%s", err)
+		}
+		base.Green("generated %s", jsOut)
+	}
+}
+
+func (d *Definition) validate() error {
+	var (
+		names = map[string]struct{}{}
+		ids   = map[uint64]string{}
+	)
+
+	for _, group := range d.Groups {
+		for _, event := range group.Events {
+			if !token.IsIdentifier(event.Name) || !token.IsExported(event.Name) {
+				return fmt.Errorf("event name %q is not an exported identifier", event.Name)
+			}
+
+			if _, exists := names[event.Name]; exists {
+				return fmt.Errorf("event name %q is duplicated", event.Name)
+			}
+			names[event.Name] = struct{}{}
+
+			id, err := strconv.ParseUint(event.Id, 0, 16)
+			if err != nil || id < 1 {
+				return fmt.Errorf("event %s has invalid id %q", event.Name, event.Id)
+			}
+
+			if name, exists := ids[id]; exists {
+				return fmt.Errorf("event %s reuses id %s of %s", event.Name, event.Id, name)
+			}
+			ids[id] = event.Name
+		}
+	}
+
+	return nil
+}
+
+func (d *Definition) render(text string, data interface{}) ([]byte, error) {
+	tpl, err := template.New("eventgen").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (d *Definition) writeGo(file, pkg string) error {
+	src, err := d.render(goTpl, map[string]interface{}{
+		"Pkg":    pkg,
+		"Groups": d.Groups,
+	})
+	if err != nil {
+		return err
+	}
+
+	if src, err = format.Source(src); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, src, 0644)
+}
+
+func (d *Definition) writeJs(file string) error {
+	src, err := d.render(jsTpl, d)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, src, 0644)
+}
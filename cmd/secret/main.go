@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"event/core/secret"
+
+	"github.com/grpc-boot/base"
+)
+
+// 生成主密钥，或使用EVENT_MASTER_KEY加密配置值与secrets对象
+func main() {
+	var (
+		gen     bool
+		value   string
+		section string
+	)
+
+	flag.BoolVar(&gen, "gen", false, "generate a master key")
+	flag.StringVar(&value, "value", "", "value to encrypt")
+	flag.StringVar(&section, "section", "", "json file to encrypt as the secrets section")
+	flag.Parse()
+
+	if gen {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			base.RedFatal("generate master key error:%s", err)
+		}
+		fmt.Println(hex.EncodeToString(key))
+		return
+	}
+
+	plain := []byte(value)
+	if section != "" {
+		data, err := ioutil.ReadFile(section)
+		if err != nil {
+			base.RedFatal("read section file error:%s", err)
+		}
+		plain = data
+	}
+
+	if len(plain) == 0 {
+		flag.Usage()
+		return
+	}
+
+	masterKey, err := secret.MasterKey()
+	if err != nil {
+		base.RedFatal("load master key error:%s", err)
+	}
+
+	encrypted, err := secret.Encrypt(masterKey, plain)
+	if err != nil {
+		base.RedFatal("encrypt error:%s", err)
+	}
+	fmt.Println(encrypted)
+}
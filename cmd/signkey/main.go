@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"event/core/protocol"
+
+	"github.com/grpc-boot/base"
+)
+
+// 生成LevelEcdh的Ed25519签名私钥，或输出已有私钥的公钥，公钥需要内置到客户端
+func main() {
+	var (
+		gen  bool
+		file string
+	)
+
+	flag.BoolVar(&gen, "gen", false, "generate a sign key, an existing file is not overwritten")
+	flag.StringVar(&file, "file", "./conf/ecdh/sign.key", "sign key file")
+	flag.Parse()
+
+	var (
+		signKey ed25519.PrivateKey
+		err     error
+	)
+
+	if gen {
+		signKey, err = protocol.GenerateSignKey(file)
+	} else {
+		signKey, err = protocol.LoadSignKey(file)
+	}
+
+	if err != nil {
+		base.RedFatal("sign key error:%s", err)
+	}
+	fmt.Println(hex.EncodeToString(signKey.Public().(ed25519.PublicKey)))
+}
@@ -0,0 +1,426 @@
+package components
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"event/components/adminapi"
+	"event/core/server"
+
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+const (
+	defaultConnsLimit = 100
+	pprofStopTimeout  = time.Second * 5
+)
+
+var (
+	ErrAdminNoToken  = errors.New("admin: admin.tokens is required when admin.addr is set")
+	ErrNoTarget      = errors.New("admin: one of id, user or room is required")
+	ErrBadEventId    = adminapi.ErrBadEventId
+	ErrReasonTooLong = errors.New("admin: reason is longer than 123 bytes")
+)
+
+// 管理接口的类型定义在adminapi，client不需要依赖components
+type (
+	AdminConn    = adminapi.Conn
+	AdminConns   = adminapi.Conns
+	AdminKick    = adminapi.Kick
+	AdminMessage = adminapi.Message
+	AdminRoute   = adminapi.Route
+	AdminRoutes  = adminapi.Routes
+	AdminStats   = adminapi.Stats
+	AdminPprof   = adminapi.Pprof
+)
+
+// adminComponent 带鉴权的运维接口，未配置admin.addr时不开启，请求需要携带Authorization: Bearer <token>
+type adminComponent struct {
+	app     *App
+	server  *http.Server
+	verify  server.TokenVerifier
+	started time.Time
+}
+
+func (ac *adminComponent) Name() string {
+	return ComponentAdmin
+}
+
+func (ac *adminComponent) DependsOn() []string {
+	return []string{ComponentServer}
+}
+
+func (ac *adminComponent) Init(app *App) error {
+	ac.app = app
+
+	params := app.Config().Params
+	addr := params.String("admin.addr")
+	if addr == "" {
+		return nil
+	}
+
+	tokens := params.StringSlice("admin.tokens")
+	if len(tokens) == 0 {
+		return ErrAdminNoToken
+	}
+	ac.verify = server.StaticTokens(tokens...)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/conns", ac.handle(http.MethodGet, ac.conns))
+	mux.HandleFunc("/conns/", ac.handle(http.MethodGet, ac.conn))
+	mux.HandleFunc("/kick", ac.handle(http.MethodPost, ac.kick))
+	mux.HandleFunc("/send", ac.handle(http.MethodPost, ac.send))
+	mux.HandleFunc("/broadcast", ac.handle(http.MethodPost, ac.broadcast))
+	mux.HandleFunc("/routes", ac.handle(http.MethodGet, ac.routes))
+	mux.HandleFunc("/config", ac.handle(http.MethodGet, ac.config))
+	mux.HandleFunc("/stats", ac.handle(http.MethodGet, ac.stats))
+	mux.HandleFunc("/reload", ac.handle(http.MethodPost, ac.reload))
+	mux.HandleFunc("/pprof", ac.handle("", ac.pprof))
+
+	ac.server = &http.Server{Addr: addr, Handler: mux}
+	return nil
+}
+
+func (ac *adminComponent) Start() error {
+	ac.started = time.Now()
+	if ac.server == nil {
+		return nil
+	}
+	return serveHTTP(ac.app.Logger, ac.server, "admin")
+}
+
+func (ac *adminComponent) Stop() error {
+	if ac.server == nil {
+		return nil
+	}
+	return shutdownHTTP(ac.server)
+}
+
+// handle 校验token和请求方法，method为空时不检查，返回值以json输出
+func (ac *adminComponent) handle(method string, fn func(r *http.Request) (interface{}, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ac.authorize(r) {
+			ac.app.Logger.Warn("admin unauthorized",
+				zaplogger.Event("admin"),
+				zaplogger.Addr(r.RemoteAddr),
+				zaplogger.Method(r.Method),
+				zaplogger.Path(r.URL.Path),
+			)
+			writeJson(w, http.StatusUnauthorized, adminError(server.ErrInvalidCredential))
+			return
+		}
+
+		if method != "" && r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJson(w, http.StatusMethodNotAllowed, adminError(fmt.Errorf("admin: %s not allowed", r.Method)))
+			return
+		}
+
+		value, status, err := fn(r)
+		if err != nil {
+			writeJson(w, status, adminError(err))
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			ac.app.Logger.Info("admin request",
+				zaplogger.Event("admin"),
+				zaplogger.Addr(r.RemoteAddr),
+				zaplogger.Method(r.Method),
+				zaplogger.Path(r.URL.Path),
+			)
+		}
+		writeJson(w, status, value)
+	}
+}
+
+func (ac *adminComponent) authorize(r *http.Request) bool {
+	token := r.Header.Get("Authorization")
+	if len(token) < 7 || !strings.EqualFold(token[:7], "Bearer ") {
+		return false
+	}
+	return ac.verify(strings.TrimSpace(token[7:]))
+}
+
+func adminError(err error) map[string]string {
+	return map[string]string{"error": err.Error()}
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func readJson(r *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(value)
+}
+
+func adminConn(conn *server.Conn) AdminConn {
+	id, _ := conn.GetId()
+	return AdminConn{
+		Id:       id,
+		UserId:   conn.UserId(),
+		Rooms:    conn.Rooms(),
+		Addr:     conn.PeerAddr(),
+		ClientIp: conn.ClientIp(),
+		Path:     conn.Path(),
+		Level:    conn.Level(),
+		Created:  conn.Created(),
+		Active:   conn.Active(),
+	}
+}
+
+// conns 按user、room、ip和path前缀过滤，按id排序，limit默认100
+func (ac *adminComponent) conns(r *http.Request) (interface{}, int, error) {
+	var (
+		query = r.URL.Query()
+		user  = query.Get("user")
+		room  = query.Get("room")
+		ip    = query.Get("ip")
+		path  = query.Get("path")
+		limit = defaultConnsLimit
+	)
+
+	if value := query.Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 1 {
+			return nil, http.StatusBadRequest, fmt.Errorf("admin: bad limit %s", value)
+		}
+		limit = l
+	}
+
+	conns := ac.app.Server.Filter(func(conn *server.Conn) bool {
+		return (user == "" || conn.UserId() == user) &&
+			(room == "" || conn.InRoom(room)) &&
+			(ip == "" || conn.ClientIp() == ip) &&
+			(path == "" || strings.HasPrefix(conn.Path(), path))
+	})
+
+	list := make([]AdminConn, 0, len(conns))
+	for _, conn := range conns {
+		list = append(list, adminConn(conn))
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+
+	result := AdminConns{Total: len(list), Conns: list}
+	if len(list) > limit {
+		result.Conns = list[:limit]
+	}
+	return result, http.StatusOK, nil
+}
+
+func (ac *adminComponent) conn(r *http.Request) (interface{}, int, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/conns/"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("admin: bad conn id %s", r.URL.Path)
+	}
+
+	conn, exists := ac.app.Server.Conn(id)
+	if !exists {
+		return nil, http.StatusNotFound, fmt.Errorf("admin: conn %d not found", id)
+	}
+
+	info := adminConn(conn)
+	info.Headers = conn.Headers()
+	return info, http.StatusOK, nil
+}
+
+func (ac *adminComponent) kick(r *http.Request) (interface{}, int, error) {
+	var req AdminKick
+	if err := readJson(r, &req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if req.Reason == "" {
+		req.Reason = "kicked"
+	}
+
+	// reason写入关闭帧，不能超过关闭帧的长度限制
+	if len(req.Reason) > server.MaxCloseReason {
+		return nil, http.StatusBadRequest, ErrReasonTooLong
+	}
+
+	conns, err := ac.targets(req.Id, req.User, req.Room)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	for _, conn := range conns {
+		conn.Kick(req.Reason)
+	}
+	return map[string]int{"kicked": len(conns)}, http.StatusOK, nil
+}
+
+func (ac *adminComponent) send(r *http.Request) (interface{}, int, error) {
+	var req AdminMessage
+	if err := readJson(r, &req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	pkg, err := req.Package()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	conns, err := ac.targets(req.Id, req.User, req.Room)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return map[string]int{"sent": ac.app.Server.SendTo(conns, pkg)}, http.StatusOK, nil
+}
+
+// targets 按连接id、用户或房间查找连接，用户来自握手Authorizer或处理器的Bind，房间来自处理器的Join
+func (ac *adminComponent) targets(id uint64, user, room string) ([]*server.Conn, error) {
+	switch {
+	case id > 0:
+		if conn, exists := ac.app.Server.Conn(id); exists {
+			return []*server.Conn{conn}, nil
+		}
+		return nil, nil
+	case user != "":
+		return ac.app.Server.UserConns(user), nil
+	case room != "":
+		return ac.app.Server.RoomConns(room), nil
+	}
+	return nil, ErrNoTarget
+}
+
+// broadcast 进入广播队列后返回，不等待发送完成
+func (ac *adminComponent) broadcast(r *http.Request) (interface{}, int, error) {
+	var req AdminMessage
+	if err := readJson(r, &req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if req.Id > 0 || req.User != "" || req.Room != "" {
+		return nil, http.StatusBadRequest, errors.New("admin: use /send for id, user or room")
+	}
+
+	pkg, err := req.Package()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	ac.app.Server.Broadcast(pkg)
+	return map[string]int64{"queued": ac.app.Server.TotalConns()}, http.StatusOK, nil
+}
+
+func (ac *adminComponent) routes(_ *http.Request) (interface{}, int, error) {
+	result := AdminRoutes{RateLimit: ac.app.Router.RateLimit()}
+
+	for eventId, handlers := range ac.app.Router.Events() {
+		route := AdminRoute{Event: fmt.Sprintf("0x%04x", eventId), Handlers: handlers}
+		if result.RateLimit != nil {
+			if limit, exists := result.RateLimit.Events[eventId]; exists {
+				route.Limit = &limit
+			}
+		}
+		result.Routes = append(result.Routes, route)
+	}
+
+	sort.Slice(result.Routes, func(i, j int) bool {
+		return result.Routes[i].Event < result.Routes[j].Event
+	})
+	return result, http.StatusOK, nil
+}
+
+func (ac *adminComponent) config(_ *http.Request) (interface{}, int, error) {
+	return ac.app.Redacted(), http.StatusOK, nil
+}
+
+func (ac *adminComponent) stats(_ *http.Request) (interface{}, int, error) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	conf := ac.app.Config()
+	stats := AdminStats{
+		Name:        conf.Name,
+		Ver:         conf.Ver,
+		Env:         conf.Env,
+		Started:     ac.started,
+		Uptime:      time.Since(ac.started).Seconds(),
+		Connections: ac.app.Server.TotalConns(),
+		Rejections:  make(map[string]uint64),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   mem.HeapAlloc,
+		NumGC:       mem.NumGC,
+		Pprof:       base.PprofIsRun(),
+	}
+
+	for reason, count := range ac.app.Handshake.Rejections() {
+		stats.Rejections[string(reason)] = count
+	}
+	return stats, http.StatusOK, nil
+}
+
+func (ac *adminComponent) reload(_ *http.Request) (interface{}, int, error) {
+	report, err := ac.app.Reload()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return report, http.StatusOK, nil
+}
+
+// pprof GET查看状态，POST {"enable":true}在pprofAddr上开启，false关闭
+func (ac *adminComponent) pprof(r *http.Request) (interface{}, int, error) {
+	addr := ac.app.Config().PprofAddr
+
+	switch r.Method {
+	case http.MethodGet:
+		return AdminPprof{Enable: base.PprofIsRun(), Addr: addr}, http.StatusOK, nil
+	case http.MethodPost:
+		var req AdminPprof
+		if err := readJson(r, &req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		if addr == "" {
+			return nil, http.StatusBadRequest, errors.New("admin: pprofAddr is not set")
+		}
+
+		if err := ac.togglePprof(addr, req.Enable); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		// 开启时在后台监听，监听失败只记录日志
+		return AdminPprof{Enable: req.Enable, Addr: addr}, http.StatusOK, nil
+	}
+	return nil, http.StatusMethodNotAllowed, fmt.Errorf("admin: %s not allowed", r.Method)
+}
+
+func (ac *adminComponent) togglePprof(addr string, enable bool) error {
+	if !enable {
+		ctx, cancel := context.WithTimeout(context.Background(), pprofStopTimeout)
+		defer cancel()
+		return base.StopPprof(ctx)
+	}
+
+	if base.PprofIsRun() {
+		return nil
+	}
+
+	go func() {
+		if err := base.StartPprof(addr, nil); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ac.app.Logger.Error("start pprof failed",
+				zaplogger.Event("pprof start"),
+				zaplogger.Error(err),
+			)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,102 @@
+// Package adminapi 管理接口的请求与响应，服务端与client共用，不依赖components
+package adminapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"event/core/ratelimit"
+
+	"github.com/grpc-boot/base"
+)
+
+var (
+	ErrBadEventId = errors.New("admin: bad event id")
+)
+
+// Conn 连接信息，Headers只在查看单个连接时返回
+type Conn struct {
+	Id       uint64      `json:"id"`
+	UserId   string      `json:"userId,omitempty"`
+	Rooms    []string    `json:"rooms,omitempty"`
+	Addr     string      `json:"addr"`
+	ClientIp string      `json:"clientIp"`
+	Path     string      `json:"path"`
+	Level    uint8       `json:"level"`
+	Created  time.Time   `json:"created"`
+	Active   time.Time   `json:"active"`
+	Headers  http.Header `json:"headers,omitempty"`
+}
+
+type Conns struct {
+	Total int    `json:"total"`
+	Conns []Conn `json:"conns"`
+}
+
+// Kick id、user、room三选一
+type Kick struct {
+	Id     uint64 `json:"id,omitempty"`
+	User   string `json:"user,omitempty"`
+	Room   string `json:"room,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Message 发送的消息，Event支持0x0300和768两种写法，/send时id、user、room三选一
+type Message struct {
+	Id    uint64         `json:"id,omitempty"`
+	User  string         `json:"user,omitempty"`
+	Room  string         `json:"room,omitempty"`
+	Event string         `json:"event"`
+	Name  string         `json:"name,omitempty"`
+	Param base.JsonParam `json:"param,omitempty"`
+}
+
+// Package 解析Event，不是合法的事件id时返回ErrBadEventId
+func (m *Message) Package() (*base.Package, error) {
+	id, err := strconv.ParseUint(m.Event, 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadEventId, m.Event)
+	}
+
+	return &base.Package{Id: uint16(id), Name: m.Name, Param: m.Param}, nil
+}
+
+type Route struct {
+	Event    string                `json:"event"`
+	Handlers int                   `json:"handlers"`
+	Limit    *ratelimit.EventLimit `json:"limit,omitempty"`
+}
+
+type Routes struct {
+	Routes    []Route           `json:"routes"`
+	RateLimit *ratelimit.Option `json:"rateLimit,omitempty"`
+}
+
+type Stats struct {
+	Name        string            `json:"name"`
+	Ver         string            `json:"ver"`
+	Env         string            `json:"env"`
+	Started     time.Time         `json:"started"`
+	Uptime      float64           `json:"uptime"`
+	Connections int64             `json:"connections"`
+	Rejections  map[string]uint64 `json:"rejections"`
+	Goroutines  int               `json:"goroutines"`
+	HeapAlloc   uint64            `json:"heapAlloc"`
+	NumGC       uint32            `json:"numGC"`
+	Pprof       bool              `json:"pprof"`
+}
+
+type Pprof struct {
+	Enable bool   `json:"enable"`
+	Addr   string `json:"addr,omitempty"`
+}
+
+// ReloadReport Restart中的key保持旧值，Failed为应用失败的组件
+type ReloadReport struct {
+	Applied []string `json:"applied"`
+	Restart []string `json:"restart"`
+	Failed  []string `json:"failed"`
+}
@@ -0,0 +1,260 @@
+package components
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"event/components/router"
+	"event/core/config"
+	"event/core/metrics"
+	"event/core/protocol"
+	"event/core/server"
+	"event/core/tracing"
+	"event/core/zapkey"
+
+	"github.com/grpc-boot/base"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrComponentExists  = errors.New("app: component already exists")
+	ErrComponentUnknown = errors.New("app: unknown dependency")
+	ErrComponentCycle   = errors.New("app: dependency cycle")
+	ErrNoRoutes         = errors.New("app: routes is nil")
+)
+
+// Component 应用组件，Init按依赖顺序执行，Stop按Start的相反顺序执行
+type Component interface {
+	Name() string
+	// DependsOn 需要先初始化的组件
+	DependsOn() []string
+	Init(app *App) error
+	Start() error
+	Stop() error
+}
+
+// Simple 由函数组成的组件，未设置的阶段什么都不做
+type Simple struct {
+	Id      string
+	Depends []string
+	OnInit  func(app *App) error
+	OnStart func() error
+	OnStop  func() error
+}
+
+func (s *Simple) Name() string {
+	return s.Id
+}
+
+func (s *Simple) DependsOn() []string {
+	return s.Depends
+}
+
+func (s *Simple) Init(app *App) error {
+	if s.OnInit == nil {
+		return nil
+	}
+	return s.OnInit(app)
+}
+
+func (s *Simple) Start() error {
+	if s.OnStart == nil {
+		return nil
+	}
+	return s.OnStart()
+}
+
+func (s *Simple) Stop() error {
+	if s.OnStop == nil {
+		return nil
+	}
+	return s.OnStop()
+}
+
+// Routes 创建事件路由，一般为events.LoadRouter
+type Routes func(app *App) (*router.Route, error)
+
+// App 持有配置和各组件，字段在对应组件Init之后可用
+type App struct {
+	Logger    *zap.Logger
+	KeyRing   *protocol.KeyRing
+	Accept    *protocol.Accept
+	Handshake *server.Handshake
+	Router    *router.Route
+	Server    *server.Server
+	// Metrics 未配置metrics.addr时为nil
+	Metrics *metrics.Registry
+	// Tracer 未配置trace.exporter时为nil
+	Tracer *tracing.Tracer
+
+	conf         atomic.Value
+	secretKeys   atomic.Value
+	configOption config.Option
+	routes       Routes
+
+	components []Component
+	started    []Component
+
+	reloadMutex sync.Mutex
+	reloaders   []*reloader
+
+	// 日志级别和打码的key属于App，由日志组件初始化
+	logLevel   zap.AtomicLevel
+	startLevel zapcore.Level
+	redactor   *zapkey.Redactor
+}
+
+// NewApp 加载并校验配置，注册内置组件，不初始化任何组件
+func NewApp(opt config.Option, routes Routes) (*App, error) {
+	result, err := LoadConfig(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{
+		configOption: opt,
+		routes:       routes,
+		logLevel:     zap.NewAtomicLevel(),
+	}
+	app.conf.Store(result.Config)
+	app.secretKeys.Store(result.SecretKeys)
+
+	for _, component := range builtin() {
+		if err = app.Use(component); err != nil {
+			return nil, err
+		}
+	}
+	return app, nil
+}
+
+// Config 当前生效的配置，Reload后会替换
+func (a *App) Config() *base.Config {
+	return a.conf.Load().(*base.Config)
+}
+
+// IsSecret key的值是否来自env:、file:或enc:引用
+func (a *App) IsSecret(key string) bool {
+	for _, secretKey := range a.secrets() {
+		if secretKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted 用于输出的配置副本，密钥已打码
+func (a *App) Redacted() base.Config {
+	return Redacted(a.Config(), a.secrets()...)
+}
+
+func (a *App) secrets() []string {
+	return a.secretKeys.Load().([]string)
+}
+
+// Use 注册组件，需要在Init之前调用
+func (a *App) Use(components ...Component) error {
+	for _, component := range components {
+		if a.component(component.Name()) != nil {
+			return fmt.Errorf("%w: %s", ErrComponentExists, component.Name())
+		}
+		a.components = append(a.components, component)
+	}
+	return nil
+}
+
+func (a *App) component(name string) Component {
+	for _, component := range a.components {
+		if component.Name() == name {
+			return component
+		}
+	}
+	return nil
+}
+
+// sorted 按依赖排序，没有依赖关系的组件保持注册顺序
+func (a *App) sorted() ([]Component, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	var (
+		state  = make(map[string]int, len(a.components))
+		sorted = make([]Component, 0, len(a.components))
+		visit  func(component Component) error
+	)
+
+	visit = func(component Component) error {
+		switch state[component.Name()] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrComponentCycle, component.Name())
+		case visited:
+			return nil
+		}
+
+		state[component.Name()] = visiting
+		for _, name := range component.DependsOn() {
+			dependency := a.component(name)
+			if dependency == nil {
+				return fmt.Errorf("%w: %s depends on %s", ErrComponentUnknown, component.Name(), name)
+			}
+
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		state[component.Name()] = visited
+		sorted = append(sorted, component)
+		return nil
+	}
+
+	for _, component := range a.components {
+		if err := visit(component); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// Init 按依赖顺序初始化全部组件
+func (a *App) Init() error {
+	sorted, err := a.sorted()
+	if err != nil {
+		return err
+	}
+
+	a.components = sorted
+	for _, component := range a.components {
+		if err = component.Init(a); err != nil {
+			return fmt.Errorf("init %s: %w", component.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Start 按初始化顺序启动，失败时停止已启动的组件
+func (a *App) Start() error {
+	for _, component := range a.components {
+		if err := component.Start(); err != nil {
+			_ = a.Stop()
+			return fmt.Errorf("start %s: %w", component.Name(), err)
+		}
+		a.started = append(a.started, component)
+	}
+	return nil
+}
+
+// Stop 按启动的相反顺序停止，某个组件失败时继续停止其他组件，返回第一个错误
+func (a *App) Stop() (err error) {
+	for index := len(a.started) - 1; index >= 0; index-- {
+		if er := a.started[index].Stop(); er != nil && err == nil {
+			err = fmt.Errorf("stop %s: %w", a.started[index].Name(), er)
+		}
+	}
+	a.started = nil
+	return err
+}
@@ -0,0 +1,185 @@
+package components
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"event/core/server"
+	"event/core/zapkey"
+
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestApp_Lifecycle(t *testing.T) {
+	var (
+		app   = &App{}
+		trace []string
+	)
+
+	component := func(name string, depends ...string) Component {
+		return &Simple{
+			Id:      name,
+			Depends: depends,
+			OnInit: func(app *App) error {
+				trace = append(trace, "init "+name)
+				return nil
+			},
+			OnStop: func() error {
+				trace = append(trace, "stop "+name)
+				return nil
+			},
+		}
+	}
+
+	// 注册顺序与依赖顺序相反
+	_ = app.Use(component("metrics", "server"), component("server", "router"), component("router"))
+	if err := app.Use(component("router")); !errors.Is(err, ErrComponentExists) {
+		t.Fatalf("want %v, got %v", ErrComponentExists, err)
+	}
+
+	if err := app.Init(); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if err := app.Start(); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if err := app.Stop(); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	want := "init router,init server,init metrics,stop metrics,stop server,stop router"
+	if got := strings.Join(trace, ","); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	app = &App{}
+	_ = app.Use(component("a", "b"), component("b", "a"))
+	if err := app.Init(); !errors.Is(err, ErrComponentCycle) {
+		t.Fatalf("want %v, got %v", ErrComponentCycle, err)
+	}
+
+	app = &App{}
+	_ = app.Use(component("a", "missing"))
+	if err := app.Init(); !errors.Is(err, ErrComponentUnknown) {
+		t.Fatalf("want %v, got %v", ErrComponentUnknown, err)
+	}
+}
+
+func TestApp_LogLevel(t *testing.T) {
+	a := &App{logLevel: zap.NewAtomicLevelAt(zapcore.WarnLevel), startLevel: zapcore.WarnLevel}
+	b := &App{logLevel: zap.NewAtomicLevelAt(zapcore.InfoLevel), startLevel: zapcore.InfoLevel}
+
+	if err := a.reloadLogLevel(&base.Config{Logger: zaplogger.Option{Level: int8(zapcore.ErrorLevel)}}); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if a.LogLevel() != zapcore.ErrorLevel || b.LogLevel() != zapcore.InfoLevel {
+		t.Fatalf("want error and info, got %s and %s", a.LogLevel(), b.LogLevel())
+	}
+
+	if err := a.reloadLogLevel(&base.Config{Logger: zaplogger.Option{Level: int8(zapcore.DebugLevel)}}); !errors.Is(err, ErrRestartRequired) {
+		t.Fatalf("want %v, got %v", ErrRestartRequired, err)
+	}
+}
+
+// 同一进程中的两个App各自持有日志文件、级别和打码的key
+func TestApp_Logger(t *testing.T) {
+	newApp := func(level zapcore.Level, redact ...interface{}) (*App, *loggerComponent, string) {
+		app := &App{logLevel: zap.NewAtomicLevel()}
+		path := t.TempDir()
+		app.conf.Store(&base.Config{
+			Logger: zaplogger.Option{Level: int8(level), Path: path},
+			Params: base.JsonParam{"log.redact": redact},
+		})
+
+		lc := &loggerComponent{}
+		if err := lc.Init(app); err != nil {
+			t.Fatalf("want nil, got %v", err)
+		}
+		return app, lc, path
+	}
+
+	a, al, aPath := newApp(zapcore.InfoLevel, "password")
+	b, bl, bPath := newApp(zapcore.DebugLevel)
+
+	param := base.JsonParam{"password": "p@ss"}
+	a.Logger.Debug("hidden", zapkey.Param(param))
+	a.Logger.Info("login", zapkey.Param(param))
+	b.Logger.Debug("login", zapkey.Param(param))
+
+	_ = al.Stop()
+	_ = bl.Stop()
+
+	read := func(path string, level zapcore.Level) string {
+		data, _ := ioutil.ReadFile(filepath.Join(path, level.String()+"-"+time.Now().Format(logDayFormat)+".log"))
+		return string(data)
+	}
+
+	if got := read(aPath, zapcore.InfoLevel); !strings.Contains(got, `"password":"******"`) {
+		t.Fatalf("want redacted, got %s", got)
+	}
+
+	if got := read(aPath, zapcore.DebugLevel); got != "" {
+		t.Fatalf("want no debug log, got %s", got)
+	}
+
+	if got := read(bPath, zapcore.DebugLevel); !strings.Contains(got, `"password":"p@ss"`) {
+		t.Fatalf("want not redacted, got %s", got)
+	}
+}
+
+func TestAdmin_Handle(t *testing.T) {
+	ac := &adminComponent{
+		app:    &App{Logger: zap.NewNop()},
+		verify: server.StaticTokens("secret"),
+	}
+
+	handler := ac.handle(http.MethodGet, func(r *http.Request) (interface{}, int, error) {
+		return map[string]bool{"ok": true}, http.StatusOK, nil
+	})
+
+	cases := []struct {
+		method string
+		token  string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodGet, "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodPost, "Bearer secret", http.StatusMethodNotAllowed},
+		{http.MethodGet, "bearer secret", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/stats", nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", c.token)
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != c.status {
+			t.Fatalf("%s %q: want %d, got %d", c.method, c.token, c.status, w.Code)
+		}
+	}
+
+	msg := AdminMessage{Event: "0x0300"}
+	if pkg, err := msg.Package(); err != nil || pkg.Id != 0x0300 {
+		t.Fatalf("want 0x0300, got %v %v", pkg, err)
+	}
+
+	msg.Event = "0x10000"
+	if _, err := msg.Package(); !errors.Is(err, ErrBadEventId) {
+		t.Fatalf("want %v, got %v", ErrBadEventId, err)
+	}
+}
@@ -1,46 +1,190 @@
 package components
 
 import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"math/rand"
 	"time"
 
-	"event/lib/constant"
+	"event/core/protocol"
+	"event/core/server"
 
 	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
 )
 
-var (
-	conf *base.Config
+const (
+	ComponentLogger    = "logger"
+	ComponentKeyRing   = "keyRing"
+	ComponentAccept    = "accept"
+	ComponentHandshake = "handshake"
+	ComponentRouter    = "router"
+	ComponentServer    = "server"
+	ComponentMetrics   = "metrics"
+	ComponentTracing   = "tracing"
+	ComponentAdmin     = "admin"
 )
 
-func Bootstrap() {
+// builtin 内置组件，新增的组件通过DependsOn声明依赖
+func builtin() []Component {
+	return []Component{
+		&loggerComponent{},
+		&Simple{Id: ComponentKeyRing, Depends: []string{ComponentLogger}, OnInit: loadAes},
+		&Simple{Id: ComponentAccept, Depends: []string{ComponentKeyRing}, OnInit: loadAccept},
+		&Simple{Id: ComponentHandshake, Depends: []string{ComponentAccept}, OnInit: loadHandshake},
+		&Simple{Id: ComponentRouter, Depends: []string{ComponentLogger}, OnInit: loadRouter},
+		&metricsComponent{},
+		&tracingComponent{},
+		&serverComponent{},
+		&adminComponent{},
+	}
+}
+
+func loadAes(app *App) error {
 	rand.Seed(time.Now().UnixNano())
 
-	conf = base.DefaultContainer.Config()
+	conf := app.Config()
+	primary, keys, err := aesKeys(conf.Params)
+	if err != nil {
+		return err
+	}
 
-	loadAes()
-	loadAccept()
+	ring, err := protocol.NewKeyRing(primary, keys...)
+	if err != nil {
+		return err
+	}
+
+	if !conf.IsEnv("dev") && !app.IsSecret("aes.keys") && !app.IsSecret("aes.key") {
+		app.Logger.Warn("aes keys are stored in plain text, use env:, file: or enc: references",
+			zaplogger.Event("keyring"),
+		)
+	}
+
+	app.KeyRing = ring
+	app.OnReload(reloadKeyRing(app), "aes.key", "aes.primary", "aes.keys")
+	return nil
 }
 
-func loadAes() {
-	aesKey := conf.Params.String("aes.key")
-	if len(aesKey) != 32 {
-		base.RedFatal("aes key length is not 32")
+// aesKeys 优先使用aes.keys，未配置时把aes.key作为key id为空的唯一密钥
+func aesKeys(params base.JsonParam) (primary string, keys []protocol.AesKey, err error) {
+	value, exists := params["aes.keys"]
+	if !exists {
+		return "", []protocol.AesKey{{Key: params.String("aes.key")}}, nil
 	}
-	aes, err := base.NewAes(aesKey[0:16], aesKey[16:])
+
+	data, err := json.Marshal(value)
 	if err != nil {
-		base.RedFatal("load aes failed")
+		return "", nil, err
+	}
+
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return "", nil, err
 	}
-	base.DefaultContainer.Set(constant.Aes, aes)
+	return params.String("aes.primary"), keys, nil
 }
 
-func loadAccept() {
-	aes, exists := base.DefaultContainer.Get(constant.Aes)
-	if !exists {
-		base.RedFatal("aes not exists")
+// reloadKeyRing 重新加载密钥环，已建立的连接不受影响
+func reloadKeyRing(app *App) Applier {
+	return func(c *base.Config) error {
+		primary, keys, err := aesKeys(c.Params)
+		if err != nil {
+			return err
+		}
+
+		if err = app.KeyRing.Load(primary, keys...); err != nil {
+			return err
+		}
+
+		app.Logger.Info("aes keys reloaded",
+			zaplogger.Event("keyring"),
+			zaplogger.Value(app.KeyRing.Ids()),
+		)
+		return nil
 	}
+}
+
+func loadAccept(app *App) error {
+	conf := app.Config()
 
 	level := uint8(conf.Params.Int64("accept.level"))
-	accept := base.NewAccept(aes.(*base.Aes), level)
-	base.DefaultContainer.Set(constant.Accept, accept)
+	accept := protocol.NewAcceptWithKeyRing(app.KeyRing, level)
+
+	// 配置签名私钥后开启LevelEcdh，公钥需要内置到客户端
+	if file := conf.Params.String("ecdh.signKeyFile"); file != "" {
+		// 私钥需要先用cmd/signkey -gen生成
+		signKey, err := protocol.LoadSignKey(file)
+		if err != nil {
+			return fmt.Errorf("load ecdh sign key: %w", err)
+		}
+
+		accept.WithSignKey(signKey)
+		base.Green("ecdh sign public key:%s", hex.EncodeToString(signKey.Public().(ed25519.PublicKey)))
+	}
+
+	app.Accept = accept
+	app.OnReload(func(c *base.Config) error {
+		accept.SetLevel(uint8(c.Params.Int64("accept.level")))
+		return nil
+	}, "accept.level")
+	return nil
+}
+
+func loadHandshake(app *App) error {
+	conf := app.Config()
+
+	handshake := server.NewHandshake(app.Accept)
+	handshake.WithOrigins(conf.Params.StringSlice("handshake.origins")...)
+	handshake.WithHeaders(conf.Params.StringSlice("handshake.headers")...)
+
+	if err := handshake.WithTrustedProxies(conf.Params.StringSlice("handshake.trustedProxies")...); err != nil {
+		return err
+	}
+
+	limiter, err := server.NewIpLimiter(ipLimitOption(conf.Params))
+	if err != nil {
+		return err
+	}
+	handshake.WithIpLimiter(limiter)
+	app.OnReload(func(c *base.Config) error {
+		return limiter.Update(ipLimitOption(c.Params))
+	}, "limit.")
+
+	// 未配置token时不鉴权
+	if tokens := conf.Params.StringSlice("handshake.tokens"); len(tokens) > 0 {
+		verify := server.StaticTokens(tokens...)
+		if name := conf.Params.String("handshake.tokenQuery"); name != "" {
+			handshake.WithAuthorizer(server.NewQueryToken(name, verify))
+		}
+
+		if name := conf.Params.String("handshake.tokenHeader"); name != "" {
+			handshake.WithAuthorizer(server.NewHeaderToken(name, verify))
+		}
+
+		if name := conf.Params.String("handshake.tokenCookie"); name != "" {
+			handshake.WithAuthorizer(server.NewCookieToken(name, verify))
+		}
+	}
+
+	app.Handshake = handshake
+	return nil
+}
+
+func loadRouter(app *App) (err error) {
+	if app.routes == nil {
+		return ErrNoRoutes
+	}
+
+	app.Router, err = app.routes(app)
+	return err
+}
+
+func ipLimitOption(params base.JsonParam) server.IpLimitOption {
+	return server.IpLimitOption{
+		MaxConns:  params.Int("limit.ipMaxConns"),
+		Rate:      params.Float64("limit.ipHandshakeRate"),
+		Burst:     params.Int("limit.ipHandshakeBurst"),
+		Allowlist: params.StringSlice("limit.allowlist"),
+	}
 }
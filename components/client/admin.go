@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"event/components/adminapi"
+)
+
+const (
+	adminTimeout = time.Second * 10
+)
+
+// AdminError 管理接口返回的错误
+type AdminError struct {
+	Status  int
+	Message string
+}
+
+func (ae *AdminError) Error() string {
+	if ae.Message == "" {
+		return fmt.Sprintf("admin: %d %s", ae.Status, http.StatusText(ae.Status))
+	}
+	return fmt.Sprintf("%s (%d)", ae.Message, ae.Status)
+}
+
+// ConnQuery 连接过滤条件，为空的字段不过滤
+type ConnQuery struct {
+	User  string
+	Room  string
+	Ip    string
+	Path  string
+	Limit int
+}
+
+// Admin 管理接口客户端
+type Admin struct {
+	baseUrl string
+	token   string
+	client  *http.Client
+}
+
+// NewAdmin addr为host:port时使用http
+func NewAdmin(addr, token string) *Admin {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &Admin{
+		baseUrl: strings.TrimRight(addr, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: adminTimeout},
+	}
+}
+
+func (a *Admin) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, a.baseUrl+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		return &AdminError{Status: resp.StatusCode, Message: result.Error}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (a *Admin) Conns(query ConnQuery) (*adminapi.Conns, error) {
+	values := neturl.Values{}
+	for key, value := range map[string]string{"user": query.User, "room": query.Room, "ip": query.Ip, "path": query.Path} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	if query.Limit > 0 {
+		values.Set("limit", strconv.Itoa(query.Limit))
+	}
+
+	path := "/conns"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	var conns adminapi.Conns
+	return &conns, a.do(http.MethodGet, path, nil, &conns)
+}
+
+func (a *Admin) Conn(id uint64) (*adminapi.Conn, error) {
+	var conn adminapi.Conn
+	return &conn, a.do(http.MethodGet, "/conns/"+strconv.FormatUint(id, 10), nil, &conn)
+}
+
+// Kick 返回关闭的连接数
+func (a *Admin) Kick(kick adminapi.Kick) (int, error) {
+	var result struct {
+		Kicked int `json:"kicked"`
+	}
+	err := a.do(http.MethodPost, "/kick", kick, &result)
+	return result.Kicked, err
+}
+
+// Send 返回发送成功的连接数
+func (a *Admin) Send(msg adminapi.Message) (int, error) {
+	var result struct {
+		Sent int `json:"sent"`
+	}
+	err := a.do(http.MethodPost, "/send", msg, &result)
+	return result.Sent, err
+}
+
+// Broadcast 返回进入广播队列时的连接数
+func (a *Admin) Broadcast(msg adminapi.Message) (int64, error) {
+	var result struct {
+		Queued int64 `json:"queued"`
+	}
+	err := a.do(http.MethodPost, "/broadcast", msg, &result)
+	return result.Queued, err
+}
+
+func (a *Admin) Routes() (*adminapi.Routes, error) {
+	var routes adminapi.Routes
+	return &routes, a.do(http.MethodGet, "/routes", nil, &routes)
+}
+
+// Config 密钥已打码的配置
+func (a *Admin) Config() (json.RawMessage, error) {
+	var conf json.RawMessage
+	err := a.do(http.MethodGet, "/config", nil, &conf)
+	return conf, err
+}
+
+func (a *Admin) Stats() (*adminapi.Stats, error) {
+	var stats adminapi.Stats
+	return &stats, a.do(http.MethodGet, "/stats", nil, &stats)
+}
+
+func (a *Admin) Reload() (*adminapi.ReloadReport, error) {
+	var report adminapi.ReloadReport
+	return &report, a.do(http.MethodPost, "/reload", nil, &report)
+}
+
+func (a *Admin) Pprof() (*adminapi.Pprof, error) {
+	var pprof adminapi.Pprof
+	return &pprof, a.do(http.MethodGet, "/pprof", nil, &pprof)
+}
+
+func (a *Admin) SetPprof(enable bool) (*adminapi.Pprof, error) {
+	var pprof adminapi.Pprof
+	return &pprof, a.do(http.MethodPost, "/pprof", adminapi.Pprof{Enable: enable}, &pprof)
+}
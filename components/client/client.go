@@ -2,12 +2,20 @@ package client
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
+	neturl "net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"event/core/chunk"
+	"event/core/codec"
+	"event/core/protocol"
+	"event/core/tracing"
+
 	"github.com/gorilla/websocket"
 	"github.com/grpc-boot/base"
 )
@@ -17,8 +25,22 @@ type Client struct {
 	baseServerUri string
 	level         uint8
 	aes           *base.Aes
+	keyId         string
+	serverKey     ed25519.PublicKey
+	ecdhKey       *protocol.EcdhKey
 	key           []byte
 	protocol      base.Protocol
+	codec         codec.Codec
+
+	compress        bool
+	compressLevel   int
+	compressMinSize int
+
+	chunkSize int
+	assembler *chunk.Assembler
+	handler   func(pkg *base.Package)
+
+	tlsConfig *tls.Config
 }
 
 func NewClient(uri string, level uint8, aes *base.Aes) (client *Client, err error) {
@@ -31,6 +53,50 @@ func NewClient(uri string, level uint8, aes *base.Aes) (client *Client, err erro
 	return client, err
 }
 
+// WithKeyId 握手时携带密钥环中的key id，未设置时服务端使用primary密钥
+func (c *Client) WithKeyId(keyId string) {
+	c.keyId = keyId
+}
+
+// WithServerKey LevelEcdh校验服务端签名使用的Ed25519公钥，此时不需要aes
+func (c *Client) WithServerKey(serverKey ed25519.PublicKey) {
+	c.serverKey = serverKey
+}
+
+func (c *Client) WithCodec(cdc codec.Codec) {
+	c.codec = cdc
+}
+
+// WithCompression 协商permessage-deflate，仅压缩不小于minSize的消息
+func (c *Client) WithCompression(level, minSize int) {
+	c.compress = true
+	c.compressLevel = level
+	c.compressMinSize = minSize
+}
+
+// WithChunk 开启分片包重组，SendChunked按opt.ChunkSize拆分
+func (c *Client) WithChunk(opt chunk.Option, progress chunk.Progress) {
+	c.chunkSize = opt.ChunkSize
+	c.assembler = chunk.NewAssembler(opt, progress)
+}
+
+// OnPackage 收到完整包后的回调，未设置时输出到终端
+func (c *Client) OnPackage(handler func(pkg *base.Package)) {
+	c.handler = handler
+}
+
+// WithTLS 连接wss地址时使用的tls配置，双向认证时在config中设置Certificates
+func (c *Client) WithTLS(config *tls.Config) {
+	c.tlsConfig = config
+}
+
+func (c *Client) cdc() codec.Codec {
+	if c.codec == nil {
+		c.codec, _ = codec.Get(codec.NameJson)
+	}
+	return c.codec
+}
+
 func (c *Client) buildUri() (uri string, err error) {
 	url := strings.Builder{}
 	url.WriteString(c.baseServerUri)
@@ -44,20 +110,50 @@ func (c *Client) buildUri() (uri string, err error) {
 	url.WriteString("l=")
 	url.WriteString(strconv.Itoa(int(c.level)))
 
+	if c.keyId != "" && protocol.Encrypted(c.level) {
+		url.WriteString("&kid=")
+		url.WriteString(neturl.QueryEscape(c.keyId))
+	}
+
+	if c.codec != nil {
+		url.WriteString("&c=")
+		url.WriteString(c.codec.Name())
+	}
+
 	switch c.level {
-	case base.LevelV2:
+	case protocol.LevelEcdh:
+		if c.ecdhKey, err = protocol.NewEcdhKey(); err != nil {
+			return "", err
+		}
+		c.protocol = nil
+		url.WriteString("&k=")
+		url.WriteString(hex.EncodeToString(c.ecdhKey.Public))
+	case protocol.LevelAead:
+		// 每次握手都使用新的随机密钥，不复用上一个连接的协议
+		if c.key, err = protocol.NewAeadSecret(); err != nil {
+			return "", err
+		}
+		c.protocol = nil
+		url.WriteString("&k=")
+		url.WriteString(hex.EncodeToString(c.aes.CbcEncrypt(c.key)))
+	case base.LevelV2, protocol.LevelCompactV2:
 		c.key = base.RandBytes(16)
 		k := c.aes.CbcEncrypt(c.key)
 		url.WriteString("&k=")
 		url.WriteString(hex.EncodeToString(k))
-	case base.LevelV1:
+	case base.LevelV1, protocol.LevelCompactV1:
 		key := make([]byte, 0, 32)
 		key = append(key, base.RandBytes(16)...)
 		key = append(key, base.RandBytes(16)...)
 		k := c.aes.CbcEncrypt(key)
 
 		if c.protocol == nil {
-			c.protocol, err = base.NewV1(c.aes, k)
+			if c.level == protocol.LevelCompactV1 {
+				c.protocol, err = protocol.NewCompactV1(c.aes, k, c.cdc())
+			} else {
+				c.protocol, err = base.NewV1(c.aes, k)
+			}
+
 			if err != nil {
 				return "", err
 			}
@@ -65,9 +161,18 @@ func (c *Client) buildUri() (uri string, err error) {
 
 		url.WriteString("&k=")
 		url.WriteString(hex.EncodeToString(k))
+	case protocol.LevelCompact:
+		if c.protocol == nil {
+			c.protocol = protocol.NewCompact(c.cdc())
+		}
 	default:
 		if c.protocol == nil {
-			c.protocol, err = base.NewV0()
+			if c.cdc().Binary() {
+				c.protocol = protocol.NewPlain(c.codec)
+			} else {
+				c.protocol, err = base.NewV0()
+			}
+
 			if err != nil {
 				return "", err
 			}
@@ -85,13 +190,24 @@ func (c *Client) Dial(timeout time.Duration) (err error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	ws, _, err := websocket.DefaultDialer.DialContext(ctx, serverUrl, nil)
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = c.compress
+	dialer.TLSClientConfig = c.tlsConfig
+
+	ws, _, err := dialer.DialContext(ctx, serverUrl, nil)
 	if err != nil {
 		return err
 	}
 
+	if c.compress {
+		if err = ws.SetCompressionLevel(c.compressLevel); err != nil {
+			_ = ws.Close()
+			return err
+		}
+	}
+
 	c.conn = ws
-	if c.level > base.LevelV1 {
+	if protocol.HasResponse(c.level) {
 		for {
 			_, message, err := c.conn.ReadMessage()
 			if err != nil {
@@ -108,12 +224,22 @@ func (c *Client) Dial(timeout time.Duration) (err error) {
 				return err
 			}
 
-			if pkg.Id != base.ConnectSuccess {
+			if pkg.Id != base.EventConnectSuccess {
 				continue
 			}
 
 			if c.protocol == nil {
-				c.protocol, err = base.NewV2ForClient(c.aes, c.key, iv)
+				switch c.level {
+				case protocol.LevelEcdh:
+					c.protocol, err = protocol.NewEcdhForClient(c.serverKey, c.ecdhKey, iv)
+				case protocol.LevelAead:
+					c.protocol, err = protocol.NewAeadForClient(c.aes, c.key, iv)
+				case protocol.LevelCompactV2:
+					c.protocol, err = protocol.NewCompactV2ForClient(c.aes, c.key, iv, c.cdc())
+				default:
+					c.protocol, err = base.NewV2ForClient(c.aes, c.key, iv)
+				}
+
 				if err != nil {
 					return err
 				}
@@ -138,12 +264,72 @@ func (c *Client) watchMsg() {
 			return
 		}
 
-		base.Green("got msg: %s", message)
+		if base.Bytes2String(message) == "pong" {
+			continue
+		}
+
+		pkg, err := c.protocol.Unpack(message)
+		if err != nil {
+			base.Red("unpack msg with error:%s", err)
+			continue
+		}
+
+		c.dispatch(pkg)
 	}
 }
 
+func (c *Client) dispatch(pkg *base.Package) {
+	if pkg.Id == chunk.EventChunk && c.assembler != nil {
+		full, err := c.assembler.Add(pkg)
+		if err != nil {
+			base.Red("assemble chunk with error:%s", err)
+			return
+		}
+
+		if full == nil {
+			return
+		}
+		pkg = full
+	}
+
+	if c.handler != nil {
+		c.handler(pkg)
+		return
+	}
+
+	base.Green("got msg: %+v", *pkg)
+}
+
+func (c *Client) write(messageType int, data []byte) error {
+	if c.compress {
+		c.conn.EnableWriteCompression(len(data) >= c.compressMinSize)
+	}
+
+	return c.conn.WriteMessage(messageType, data)
+}
+
 func (c *Client) SendMsg(pkg *base.Package) error {
-	return c.conn.WriteMessage(websocket.TextMessage, c.protocol.Pack(pkg))
+	if sequenced, ok := c.protocol.(protocol.Sequenced); ok {
+		mutex := sequenced.SendMutex()
+		mutex.Lock()
+		defer mutex.Unlock()
+	}
+
+	if protocol.IsBinary(c.protocol) {
+		return c.write(websocket.BinaryMessage, c.protocol.Pack(pkg))
+	}
+
+	return c.write(websocket.TextMessage, c.protocol.Pack(pkg))
+}
+
+// SendMsgContext 把ctx中的trace context写入pkg.Param，服务端的span会以它为父span
+func (c *Client) SendMsgContext(ctx context.Context, pkg *base.Package) error {
+	pkg.Param = tracing.Inject(ctx, pkg.Param)
+	return c.SendMsg(pkg)
+}
+
+func (c *Client) SendChunked(pkg *base.Package, progress chunk.Progress) error {
+	return chunk.Send(pkg, c.chunkSize, c.SendMsg, progress)
 }
 
 func (c *Client) Close() error {
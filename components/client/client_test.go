@@ -1,12 +1,30 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"net/http"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"event/components"
+	"event/components/router"
+	"event/core/chunk"
+	"event/core/codec"
+	"event/core/config"
+	"event/core/metrics"
+	"event/core/protocol"
+	"event/core/server"
+	"event/core/tracing"
+
 	"github.com/grpc-boot/base"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// serverAddr 需要先以test profile启动服务端: event -profile test
 var (
 	aes        *base.Aes
 	serverAddr = `ws://127.0.0.1:3333/ws`
@@ -37,7 +55,7 @@ func TestClient_DialV0(t *testing.T) {
 		}
 
 		err = client.SendMsg(&base.Package{
-			Id:   base.Login,
+			Id:   base.EventLogin,
 			Name: "login",
 			Param: base.JsonParam{
 				"token": time.Now().String(),
@@ -72,7 +90,7 @@ func TestClient_DialV1(t *testing.T) {
 		}
 
 		err = client.SendMsg(&base.Package{
-			Id:   base.Login,
+			Id:   base.EventLogin,
 			Name: "login",
 			Param: base.JsonParam{
 				"token": time.Now().String(),
@@ -107,7 +125,7 @@ func TestClient_DialV2(t *testing.T) {
 		}
 
 		err = client.SendMsg(&base.Package{
-			Id:   base.Login,
+			Id:   base.EventLogin,
 			Name: "login",
 			Param: base.JsonParam{
 				"token": time.Now().String(),
@@ -120,3 +138,680 @@ func TestClient_DialV2(t *testing.T) {
 		num++
 	}
 }
+
+func TestClient_DialAead(t *testing.T) {
+	client, err := NewClient(serverAddr, protocol.LevelAead, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	received := make(chan *base.Package, 1)
+	client.OnPackage(func(pkg *base.Package) {
+		received <- pkg
+	})
+
+	// 重连时重新派生密钥，序号从头开始
+	for i := 0; i < 2; i++ {
+		if err = client.Dial(time.Second); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		err = client.SendMsg(&base.Package{
+			Id:   0x0300,
+			Name: "message",
+			Param: base.JsonParam{
+				"data": "aead",
+			},
+		})
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		select {
+		case pkg := <-received:
+			if pkg.Param.String("data") != "aead" {
+				t.Fatalf("want aead, got %+v", pkg)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("want echo, got timeout")
+		}
+		_ = client.Close()
+	}
+}
+
+func TestClient_DialEcdh(t *testing.T) {
+	signKey, err := protocol.GenerateSignKey(filepath.Join(t.TempDir(), "sign.key"))
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	ring, err := protocol.NewKeyRing("", protocol.AesKey{Key: "SD#$523asz7*&^df312c45cDvd$!F~12"})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	r := router.NewRouter()
+	r.On(0x0300, func(conn *server.Conn, pkg *base.Package) error {
+		return conn.Emit(pkg)
+	})
+
+	s, err := server.New(server.Option{
+		Addr:      "127.0.0.1:3340",
+		NumLoops:  1,
+		Handshake: server.NewHandshake(protocol.NewAcceptWithKeyRing(ring, 0).WithSignKey(signKey)),
+		Handler:   r,
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	go s.Start()
+	defer s.Shutdown(time.Second)
+
+	client, err := NewClient("ws://127.0.0.1:3340/ws", protocol.LevelEcdh, nil)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	received := make(chan *base.Package, 1)
+	client.OnPackage(func(pkg *base.Package) {
+		received <- pkg
+	})
+
+	client.WithServerKey(signKey.Public().(ed25519.PublicKey))
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	defer client.Close()
+
+	err = client.SendMsg(&base.Package{
+		Id:   0x0300,
+		Name: "message",
+		Param: base.JsonParam{
+			"data": "ecdh",
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	select {
+	case pkg := <-received:
+		if pkg.Param.String("data") != "ecdh" {
+			t.Fatalf("want ecdh, got %+v", pkg)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatalf("want echo, got timeout")
+	}
+}
+
+func TestClient_DialKeyId(t *testing.T) {
+	client, err := NewClient(serverAddr, base.LevelV2, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	client.WithKeyId("k1")
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	defer client.Close()
+
+	err = client.SendMsg(&base.Package{
+		Id:   base.EventLogin,
+		Name: "login",
+		Param: base.JsonParam{
+			"token": time.Now().String(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	client.WithKeyId("unknown")
+	if err = client.Dial(time.Second); err == nil {
+		t.Fatalf("want handshake rejected, got nil")
+	}
+}
+
+func TestClient_DialMsgPack(t *testing.T) {
+	client, err := NewClient(serverAddr, base.LevelJson, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	cdc, err := codec.Get(codec.NameMsgPack)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	client.WithCodec(cdc)
+
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	defer client.Close()
+
+	err = client.SendMsg(&base.Package{
+		Id:   0x0300,
+		Name: "message",
+		Param: base.JsonParam{
+			"current": time.Now().Unix(),
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	time.Sleep(time.Second * 2)
+}
+
+func TestClient_DialCompactV2(t *testing.T) {
+	client, err := NewClient(serverAddr, protocol.LevelCompactV2, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	cdc, err := codec.Get(codec.NameMsgPack)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	client.WithCodec(cdc)
+
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	defer client.Close()
+
+	err = client.SendMsg(&base.Package{
+		Id: 0x0300,
+		Param: base.JsonParam{
+			"current": time.Now().Unix(),
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	time.Sleep(time.Second * 2)
+}
+
+func TestClient_DialCompression(t *testing.T) {
+	client, err := NewClient(serverAddr, base.LevelJson, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	client.WithCompression(1, 128)
+
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	defer client.Close()
+
+	for _, size := range []int{16, 4096} {
+		err = client.SendMsg(&base.Package{
+			Id:   0x0300,
+			Name: "message",
+			Param: base.JsonParam{
+				"data": strings.Repeat("a", size),
+			},
+		})
+
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+	}
+
+	time.Sleep(time.Second * 3)
+}
+
+func TestClient_SendChunked(t *testing.T) {
+	client, err := NewClient(serverAddr, base.LevelV1, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	client.WithChunk(chunk.Option{ChunkSize: 16 * 1024}, nil)
+
+	data := strings.Repeat("0123456789", 20*1024)
+	got := make(chan *base.Package, 1)
+	client.OnPackage(func(pkg *base.Package) {
+		got <- pkg
+	})
+
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	defer client.Close()
+
+	var sent int
+	err = client.SendChunked(&base.Package{
+		Id:   0x0300,
+		Name: "message",
+		Param: base.JsonParam{
+			"data": data,
+		},
+	}, func(transferId string, eventId uint16, done, size int) {
+		sent = done
+	})
+
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	select {
+	case pkg := <-got:
+		if pkg.Param.String("data") != data {
+			t.Fatalf("want %d bytes, got %d", len(data), len(pkg.Param.String("data")))
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatalf("want echo package, got timeout")
+	}
+
+	if sent <= len(data) {
+		t.Fatalf("want more than %d bytes sent, got %d", len(data), sent)
+	}
+}
+
+func TestServer_New(t *testing.T) {
+	ring, err := protocol.NewKeyRing("", protocol.AesKey{Key: "SD#$523asz7*&^df312c45cDvd$!F~12"})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	// 同一进程中的两个Server互不影响
+	addrs := []string{"127.0.0.1:3341", "127.0.0.1:3342"}
+	for index, addr := range addrs {
+		name := addr
+		r := router.NewRouter()
+		r.On(0x0300, func(conn *server.Conn, pkg *base.Package) error {
+			pkg.Param["server"] = name
+			return conn.Emit(pkg)
+		})
+
+		s, err := server.New(server.Option{
+			Addr:      addr,
+			NumLoops:  1,
+			Handshake: server.NewHandshake(protocol.NewAcceptWithKeyRing(ring, 0)),
+			Handler:   r,
+		})
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		go s.Start()
+		defer s.Shutdown(time.Second)
+
+		client, err := NewClient("ws://"+addr+"/ws", base.LevelV1, aes)
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		received := make(chan *base.Package, 1)
+		client.OnPackage(func(pkg *base.Package) {
+			received <- pkg
+		})
+
+		if err = client.Dial(time.Second); err != nil {
+			t.Fatalf("server %d: want nil, got %s", index, err)
+		}
+
+		err = client.SendMsg(&base.Package{Id: 0x0300, Name: "message", Param: base.JsonParam{"data": "embed"}})
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		select {
+		case pkg := <-received:
+			if pkg.Param.String("server") != addr {
+				t.Fatalf("want %s, got %+v", addr, pkg)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("want echo, got timeout")
+		}
+		_ = client.Close()
+	}
+}
+
+func TestServer_Metrics(t *testing.T) {
+	ring, err := protocol.NewKeyRing("", protocol.AesKey{Key: "SD#$523asz7*&^df312c45cDvd$!F~12"})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	r := router.NewRouter()
+	r.On(0x0300, func(conn *server.Conn, pkg *base.Package) error {
+		return conn.Emit(pkg)
+	})
+
+	registry := metrics.NewRegistry()
+	s, err := server.New(server.Option{
+		Addr:      "127.0.0.1:3343",
+		NumLoops:  1,
+		Handshake: server.NewHandshake(protocol.NewAcceptWithKeyRing(ring, 0)),
+		Handler:   r,
+		Metrics:   registry,
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	go s.Start()
+	defer s.Shutdown(time.Second)
+
+	client, err := NewClient("ws://127.0.0.1:3343/ws", base.LevelV1, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	received := make(chan *base.Package, 1)
+	client.OnPackage(func(pkg *base.Package) {
+		received <- pkg
+	})
+
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	defer client.Close()
+
+	if err = client.SendMsg(&base.Package{Id: 0x0300, Name: "message", Param: base.JsonParam{"data": "metrics"}}); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	select {
+	case <-received:
+	case <-time.After(time.Second * 3):
+		t.Fatalf("want echo, got timeout")
+	}
+
+	var out strings.Builder
+	if err = registry.Write(&out); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	for _, line := range []string{
+		`event_ws_connections 1`,
+		`event_ws_handshakes_total{result="ok",level="1"} 1`,
+		`event_ws_messages_in_total{event="0x0300"} 1`,
+		`event_ws_messages_out_total{event="0x0300"} 1`,
+		`event_ws_handler_duration_seconds_count{event="0x0300"} 1`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Fatalf("want %s, got %s", line, out.String())
+		}
+	}
+}
+
+func TestServer_Tracing(t *testing.T) {
+	var spans bytes.Buffer
+	tracer, err := tracing.New(tracing.Option{Exporter: tracing.ExporterStdout, SampleRatio: 1, Service: "event", Writer: &spans})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	defer tracer.Shutdown(context.Background())
+
+	ring, err := protocol.NewKeyRing("", protocol.AesKey{Key: "SD#$523asz7*&^df312c45cDvd$!F~12"})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	r := router.NewRouter()
+	r.On(0x0300, func(conn *server.Conn, pkg *base.Package) error {
+		return conn.Emit(pkg)
+	})
+
+	s, err := server.New(server.Option{
+		Addr:      "127.0.0.1:3347",
+		NumLoops:  1,
+		Handshake: server.NewHandshake(protocol.NewAcceptWithKeyRing(ring, 0)),
+		Handler:   r,
+		Tracer:    tracer,
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	go s.Start()
+	defer s.Shutdown(time.Second)
+
+	client, err := NewClient("ws://127.0.0.1:3347/ws", base.LevelV1, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	received := make(chan *base.Package, 1)
+	client.OnPackage(func(pkg *base.Package) {
+		received <- pkg
+	})
+
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	defer client.Close()
+
+	ctx, span := tracer.Start(context.Background(), "client.send", time.Time{}, trace.SpanKindProducer)
+	if err = client.SendMsgContext(ctx, &base.Package{Id: 0x0300, Name: "message", Param: base.JsonParam{"data": "tracing"}}); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	span.End()
+
+	var echo *base.Package
+	select {
+	case echo = <-received:
+	case <-time.After(time.Second * 3):
+		t.Fatalf("want echo, got timeout")
+	}
+
+	// 回复中带有服务端handler span的trace context
+	got := trace.SpanContextFromContext(tracing.Extract(context.Background(), echo.Param))
+	if got.TraceID() != span.SpanContext().TraceID() {
+		t.Fatalf("want %s, got %s", span.SpanContext().TraceID(), got.TraceID())
+	}
+
+	if err = tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	for _, name := range []string{"ws.handshake", "event.message", "event.unpack", "event.handler", "event.emit"} {
+		if !strings.Contains(spans.String(), `"Name":"`+name+`"`) {
+			t.Fatalf("want %s span, got %s", name, spans.String())
+		}
+	}
+}
+
+func TestServer_Session(t *testing.T) {
+	ring, err := protocol.NewKeyRing("", protocol.AesKey{Key: "SD#$523asz7*&^df312c45cDvd$!F~12"})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	r := router.NewRouter()
+	r.On(0x0200, func(conn *server.Conn, pkg *base.Package) error {
+		conn.Bind(pkg.Param.String("user"))
+		conn.Join(pkg.Param.String("room"))
+		return conn.Emit(pkg)
+	})
+
+	s, err := server.New(server.Option{
+		Addr:      "127.0.0.1:3344",
+		NumLoops:  1,
+		Handshake: server.NewHandshake(protocol.NewAcceptWithKeyRing(ring, 0)),
+		Handler:   r,
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	go s.Start()
+	defer s.Shutdown(time.Second)
+
+	received := make(chan *base.Package, 4)
+	for _, user := range []string{"u1", "u2"} {
+		client, err := NewClient("ws://127.0.0.1:3344/ws", base.LevelV1, aes)
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		client.OnPackage(func(pkg *base.Package) {
+			received <- pkg
+		})
+
+		if err = client.Dial(time.Second); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+		defer client.Close()
+
+		if err = client.SendMsg(&base.Package{Id: 0x0200, Name: "login", Param: base.JsonParam{"user": user, "room": "r1"}}); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		select {
+		case <-received:
+		case <-time.After(time.Second * 3):
+			t.Fatalf("want login, got timeout")
+		}
+	}
+
+	conns := s.RoomConns("r1")
+	if len(conns) != 2 {
+		t.Fatalf("want 2, got %d", len(conns))
+	}
+
+	if sent := s.SendTo(conns, &base.Package{Id: 0x0300, Name: "room", Param: base.JsonParam{}}); sent != 2 {
+		t.Fatalf("want 2, got %d", sent)
+	}
+
+	for index := 0; index < 2; index++ {
+		select {
+		case pkg := <-received:
+			if pkg.Id != 0x0300 {
+				t.Fatalf("want 0x0300, got %+v", pkg)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("want room msg, got timeout")
+		}
+	}
+
+	if kicked := s.KickUser("u1", "bye"); kicked != 1 {
+		t.Fatalf("want 1, got %d", kicked)
+	}
+
+	deadline := time.Now().Add(time.Second * 3)
+	for len(s.UserConns("u1")) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("want u1 closed, got %d conns", len(s.UserConns("u1")))
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if got := s.UserConns("u2"); len(got) != 1 || got[0].Rooms()[0] != "r1" {
+		t.Fatalf("want u2 in r1, got %v", got)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	app, err := components.NewApp(config.Option{
+		File:    "../../conf/app.json",
+		Profile: "test",
+		Overrides: []string{
+			"addr=127.0.0.1:3345",
+			"logger.path=" + t.TempDir(),
+			"ecdh.signKeyFile=",
+			"metrics.addr=",
+			"admin.addr=127.0.0.1:3346",
+			"admin.tokens=t0ken",
+		},
+	}, func(app *components.App) (*router.Route, error) {
+		r := router.NewRouter()
+		r.On(0x0200, func(conn *server.Conn, pkg *base.Package) error {
+			conn.Bind(pkg.Param.String("user"))
+			return conn.Emit(pkg)
+		})
+		return r, nil
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if err = app.Init(); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if err = app.Start(); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	defer app.Stop()
+
+	client, err := NewClient("ws://127.0.0.1:3345/ws", base.LevelV1, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	received := make(chan *base.Package, 2)
+	client.OnPackage(func(pkg *base.Package) {
+		received <- pkg
+	})
+
+	if err = client.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	defer client.Close()
+
+	if err = client.SendMsg(&base.Package{Id: 0x0200, Name: "login", Param: base.JsonParam{"user": "u1"}}); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	<-received
+
+	if _, err = NewAdmin("127.0.0.1:3346", "wrong").Stats(); err == nil || err.(*AdminError).Status != http.StatusUnauthorized {
+		t.Fatalf("want 401, got %v", err)
+	}
+
+	admin := NewAdmin("127.0.0.1:3346", "t0ken")
+	conns, err := admin.Conns(ConnQuery{User: "u1"})
+	if err != nil || conns.Total != 1 || conns.Conns[0].Level != base.LevelV1 {
+		t.Fatalf("want 1 conn of u1, got %+v %v", conns, err)
+	}
+
+	sent, err := admin.Send(components.AdminMessage{User: "u1", Event: "0x0300", Name: "notice", Param: base.JsonParam{}})
+	if err != nil || sent != 1 {
+		t.Fatalf("want 1, got %d %v", sent, err)
+	}
+
+	select {
+	case pkg := <-received:
+		if pkg.Id != 0x0300 || pkg.Name != "notice" {
+			t.Fatalf("want notice, got %+v", pkg)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatalf("want notice, got timeout")
+	}
+
+	stats, err := admin.Stats()
+	if err != nil || stats.Connections != 1 {
+		t.Fatalf("want 1 connection, got %+v %v", stats, err)
+	}
+
+	routes, err := admin.Routes()
+	if err != nil || len(routes.Routes) != 1 || routes.Routes[0].Event != "0x0200" {
+		t.Fatalf("want route 0x0200, got %+v %v", routes, err)
+	}
+
+	kicked, err := admin.Kick(components.AdminKick{Id: conns.Conns[0].Id, Reason: "test"})
+	if err != nil || kicked != 1 {
+		t.Fatalf("want 1, got %d %v", kicked, err)
+	}
+
+	if _, err = admin.Kick(components.AdminKick{}); err == nil || err.(*AdminError).Status != http.StatusBadRequest {
+		t.Fatalf("want 400, got %v", err)
+	}
+
+	if _, err = admin.Kick(components.AdminKick{Id: 1, Reason: strings.Repeat("r", 124)}); err == nil || err.(*AdminError).Status != http.StatusBadRequest {
+		t.Fatalf("want 400 for long reason, got %v", err)
+	}
+}
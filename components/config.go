@@ -0,0 +1,110 @@
+package components
+
+import (
+	"event/core/config"
+	"event/core/protocol"
+	"event/core/secret"
+	"event/core/tracing"
+
+	"github.com/grpc-boot/base"
+)
+
+// Schema 全部配置项，出现未列出的key或类型、取值不合法时启动失败
+var Schema = config.Schema{
+	"name":              config.String(),
+	"env":               config.String(),
+	"ver":               config.String(),
+	"addr":              config.String(),
+	"pprofAddr":         config.String(),
+	"logger.level":      config.Int(-1, 5),
+	"logger.path":       config.String(),
+	"logger.tickSecond": config.Int(-1, config.Unlimited),
+
+	"log.redact":           config.Strings(),
+	"log.sampleInitial":    config.Int(0, config.Unlimited),
+	"log.sampleThereafter": config.Int(0, config.Unlimited),
+
+	"numLoops":       config.Int(1, config.Unlimited),
+	"maxIdleSeconds": config.Int(0, config.Unlimited),
+	"pageSize":       config.Int(1, config.Unlimited),
+	"accept.level":   config.Int(protocol.StrengthJson, protocol.StrengthAead),
+
+	"aes.key":          config.String(),
+	"aes.primary":      config.String(),
+	"aes.keys":         config.Any(),
+	"ecdh.signKeyFile": config.String(),
+
+	"compress.enable":                  config.Bool(),
+	"compress.level":                   config.Int(-2, 9),
+	"compress.minSize":                 config.Int(0, config.Unlimited),
+	"compress.serverNoContextTakeover": config.Bool(),
+	"compress.clientNoContextTakeover": config.Bool(),
+
+	"chunk.size":           config.Int(0, config.Unlimited),
+	"chunk.maxSize":        config.Int(0, config.Unlimited),
+	"chunk.maxTransfers":   config.Int(0, config.Unlimited),
+	"chunk.timeoutSeconds": config.Int(0, config.Unlimited),
+
+	"handshake.origins":        config.Strings(),
+	"handshake.tokens":         config.Strings(),
+	"handshake.tokenQuery":     config.String(),
+	"handshake.tokenHeader":    config.String(),
+	"handshake.tokenCookie":    config.String(),
+	"handshake.headers":        config.Strings(),
+	"handshake.trustedProxies": config.Strings(),
+
+	"limit.ipMaxConns":       config.Int(0, config.Unlimited),
+	"limit.ipHandshakeRate":  config.Float(0, config.Unlimited),
+	"limit.ipHandshakeBurst": config.Int(0, config.Unlimited),
+	"limit.allowlist":        config.Strings(),
+
+	"admission.maxConns":    config.Int(0, config.Unlimited),
+	"admission.maxMemoryMB": config.Int(0, config.Unlimited),
+	"admission.maxLagMs":    config.Int(0, config.Unlimited),
+	"admission.sampleMs":    config.Int(0, config.Unlimited),
+
+	"tls.enable":        config.Bool(),
+	"tls.backendAddr":   config.String(),
+	"tls.certFile":      config.String(),
+	"tls.keyFile":       config.String(),
+	"tls.clientCaFile":  config.String(),
+	"tls.clientAuth":    config.String("none", "request", "require"),
+	"tls.reloadSeconds": config.Int(0, config.Unlimited),
+
+	"message.maxFrameSize":     config.Int(0, config.Unlimited),
+	"message.maxSize":          config.Int(0, config.Unlimited),
+	"message.maxParamSize":     config.Int(0, config.Unlimited),
+	"message.maxDepth":         config.Int(0, config.Unlimited),
+	"message.maxAssembledSize": config.Int(0, config.Unlimited),
+
+	"rate.limit":         config.Float(0, config.Unlimited),
+	"rate.burst":         config.Int(0, config.Unlimited),
+	"rate.penalty":       config.String("drop", "error", "throttle", "disconnect"),
+	"rate.maxViolations": config.Int(0, config.Unlimited),
+	"rate.maxDelayMs":    config.Int(0, config.Unlimited),
+	"rate.events":        config.Any(),
+
+	"metrics.addr": config.String(),
+	"metrics.path": config.String(),
+
+	"trace.exporter":    config.String("", tracing.ExporterStdout, tracing.ExporterOtlp),
+	"trace.endpoint":    config.String(),
+	"trace.insecure":    config.Bool(),
+	"trace.sampleRatio": config.Float(0, 1),
+
+	"admin.addr":   config.String(),
+	"admin.tokens": config.Strings(),
+}
+
+// LoadConfig 按配置文件、profile、环境变量、命令行的顺序加载并校验，解析env:、file:、enc:引用
+func LoadConfig(opt config.Option) (*config.Result, error) {
+	opt.Schema = Schema
+	return config.Load(opt)
+}
+
+// Redacted 用于输出的配置副本，密钥已打码
+func Redacted(c *base.Config, secretKeys ...string) base.Config {
+	redacted := *c
+	redacted.Params = secret.Redact(c.Params, secretKeys...)
+	return redacted
+}
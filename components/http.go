@@ -0,0 +1,36 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"event/core/server"
+
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+// serveHTTP 先监听再返回，端口被占用时启动失败
+func serveHTTP(logger server.Logger, srv *http.Server, event string) error {
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("serve http failed",
+				zaplogger.Error(err),
+				zaplogger.Event(event),
+			)
+		}
+	}()
+	return nil
+}
+
+func shutdownHTTP(srv *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,243 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"event/core/zapkey"
+
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	sampleTick = time.Second
+
+	defaultLogPath    = "/tmp"
+	defaultTickSecond = 5
+	logDayFormat      = "06-01-02"
+)
+
+// LogSampling 每秒内级别和消息都相同的日志先输出Initial条，之后每Thereafter条输出一条，
+// Thereafter为0时其余的全部丢弃，Initial为0时不采样
+type LogSampling struct {
+	Initial    int
+	Thereafter int
+}
+
+// logEncoder 与zaplogger的默认格式相同
+var logEncoder = zapcore.EncoderConfig{
+	MessageKey: "Message",
+	LevelKey:   "Level",
+	TimeKey:    "DateTime",
+	EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(t.Format("2006-01-02 15:04:05"))
+	},
+	EncodeLevel:  zapcore.CapitalLevelEncoder,
+	CallerKey:    "File",
+	EncodeCaller: zapcore.ShortCallerEncoder,
+}
+
+// NewLogger 创建独立的日志，不修改base的全局日志，文件与zaplogger相同为<path>/<level>-<yy-mm-dd>.log，
+// 输出级别由level控制，redactor为nil时不打码，返回的closeFiles关闭日志文件
+func NewLogger(opt zaplogger.Option, sampling LogSampling, level zap.AtomicLevel, redactor *zapkey.Redactor) (logger *zap.Logger, closeFiles func() error, err error) {
+	start := zapcore.Level(opt.Level)
+	if start < zapcore.DebugLevel || start > zapcore.FatalLevel {
+		return nil, nil, zaplogger.ErrInvalidLevel
+	}
+
+	if opt.Path == "" {
+		opt.Path = defaultLogPath
+	}
+
+	if opt.TickSecond == 0 {
+		opt.TickSecond = defaultTickSecond
+	}
+
+	var (
+		encoder = zapcore.NewJSONEncoder(logEncoder)
+		files   = make([]*dailyFile, 0, zapcore.FatalLevel-start+1)
+		cores   = make([]zapcore.Core, 0, cap(files))
+	)
+
+	for l := start; l <= zapcore.FatalLevel; l++ {
+		file := &dailyFile{path: opt.Path, level: l.String(), tick: time.Second * time.Duration(opt.TickSecond)}
+		if err = file.open(time.Now()); err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, nil, err
+		}
+
+		files = append(files, file)
+		cores = append(cores, zapcore.NewCore(encoder, file, exactLevel(l)))
+	}
+
+	core := zapcore.NewTee(cores...)
+	if redactor != nil {
+		core = redactor.Core(core)
+	}
+
+	if c, er := zapcore.NewIncreaseLevelCore(core, level); er == nil {
+		core = c
+	}
+
+	if sampling.Initial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, sampleTick, sampling.Initial, sampling.Thereafter)
+	}
+
+	closeFiles = func() (err error) {
+		for _, file := range files {
+			if er := file.Close(); er != nil && err == nil {
+				err = er
+			}
+		}
+		return err
+	}
+	return zap.New(core), closeFiles, nil
+}
+
+func exactLevel(level zapcore.Level) zap.LevelEnablerFunc {
+	return func(l zapcore.Level) bool {
+		return l == level
+	}
+}
+
+// dailyFile 按天切换文件，每tick检查一次文件是否被移走，移走后重新创建
+type dailyFile struct {
+	mutex   sync.Mutex
+	path    string
+	level   string
+	tick    time.Duration
+	day     string
+	checked time.Time
+	file    *os.File
+}
+
+func (df *dailyFile) name(day string) string {
+	return fmt.Sprintf("%s/%s-%s.log", strings.TrimSuffix(df.path, "/"), df.level, day)
+}
+
+func (df *dailyFile) open(now time.Time) error {
+	day := now.Format(logDayFormat)
+	file, err := os.OpenFile(df.name(day), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	if df.file != nil {
+		_ = df.file.Close()
+	}
+	df.file, df.day, df.checked = file, day, now
+	return nil
+}
+
+func (df *dailyFile) Write(p []byte) (int, error) {
+	df.mutex.Lock()
+	defer df.mutex.Unlock()
+
+	now := time.Now()
+	switch {
+	case df.file == nil:
+		return 0, os.ErrClosed
+	case now.Format(logDayFormat) != df.day:
+		if err := df.open(now); err != nil {
+			return 0, err
+		}
+	case df.tick > 0 && now.Sub(df.checked) >= df.tick:
+		df.checked = now
+		if _, err := os.Stat(df.name(df.day)); os.IsNotExist(err) {
+			if err = df.open(now); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return df.file.Write(p)
+}
+
+func (df *dailyFile) Sync() error {
+	df.mutex.Lock()
+	defer df.mutex.Unlock()
+
+	if df.file == nil {
+		return nil
+	}
+	return df.file.Sync()
+}
+
+func (df *dailyFile) Close() error {
+	df.mutex.Lock()
+	defer df.mutex.Unlock()
+
+	if df.file == nil {
+		return nil
+	}
+
+	err := df.file.Close()
+	df.file = nil
+	return err
+}
+
+// loggerComponent 日志文件按启动时的级别创建，之后只能通过Reload调高级别
+type loggerComponent struct {
+	closeFiles func() error
+}
+
+func (lc *loggerComponent) Name() string {
+	return ComponentLogger
+}
+
+func (lc *loggerComponent) DependsOn() []string {
+	return nil
+}
+
+func (lc *loggerComponent) Init(app *App) (err error) {
+	conf := app.Config()
+
+	app.startLevel = zapcore.Level(conf.Logger.Level)
+	app.logLevel.SetLevel(app.startLevel)
+	app.redactor = zapkey.NewRedactor(conf.Params.StringSlice("log.redact"))
+
+	app.Logger, lc.closeFiles, err = NewLogger(conf.Logger, LogSampling{
+		Initial:    conf.Params.Int("log.sampleInitial"),
+		Thereafter: conf.Params.Int("log.sampleThereafter"),
+	}, app.logLevel, app.redactor)
+	if err != nil {
+		return err
+	}
+
+	app.OnReload(app.reloadLogLevel, "logger.level")
+	app.OnReload(func(c *base.Config) error {
+		app.redactor.SetKeys(c.Params.StringSlice("log.redact"))
+		return nil
+	}, "log.redact")
+	return nil
+}
+
+func (lc *loggerComponent) Start() error {
+	return nil
+}
+
+func (lc *loggerComponent) Stop() error {
+	return lc.closeFiles()
+}
+
+func (a *App) reloadLogLevel(c *base.Config) error {
+	level := zapcore.Level(c.Logger.Level)
+	if level < a.startLevel {
+		return fmt.Errorf("%w: level %s is below startup level %s", ErrRestartRequired, level, a.startLevel)
+	}
+
+	a.logLevel.SetLevel(level)
+	return nil
+}
+
+// LogLevel 当前生效的日志级别，日志组件初始化之前为info
+func (a *App) LogLevel() zapcore.Level {
+	return a.logLevel.Level()
+}
@@ -0,0 +1,61 @@
+package components
+
+import (
+	"net/http"
+
+	"event/core/metrics"
+)
+
+const (
+	defaultMetricsPath = "/metrics"
+)
+
+// metricsComponent 在单独的端口输出prometheus指标，未配置metrics.addr时不开启
+type metricsComponent struct {
+	app    *App
+	server *http.Server
+}
+
+func (mc *metricsComponent) Name() string {
+	return ComponentMetrics
+}
+
+func (mc *metricsComponent) DependsOn() []string {
+	return []string{ComponentLogger}
+}
+
+func (mc *metricsComponent) Init(app *App) error {
+	mc.app = app
+
+	params := app.Config().Params
+	addr := params.String("metrics.addr")
+	if addr == "" {
+		return nil
+	}
+
+	path := params.String("metrics.path")
+	if path == "" {
+		path = defaultMetricsPath
+	}
+
+	app.Metrics = metrics.NewRegistry()
+
+	mux := http.NewServeMux()
+	mux.Handle(path, app.Metrics)
+	mc.server = &http.Server{Addr: addr, Handler: mux}
+	return nil
+}
+
+func (mc *metricsComponent) Start() error {
+	if mc.server == nil {
+		return nil
+	}
+	return serveHTTP(mc.app.Logger, mc.server, "metrics")
+}
+
+func (mc *metricsComponent) Stop() error {
+	if mc.server == nil {
+		return nil
+	}
+	return shutdownHTTP(mc.server)
+}
@@ -0,0 +1,132 @@
+package components
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"event/components/adminapi"
+	"event/core/config"
+
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRestartRequired = errors.New("restart required")
+)
+
+// Applier 把新配置应用到运行中的组件，返回ErrRestartRequired时对应的key需要重启才能生效
+type Applier func(c *base.Config) error
+
+type reloader struct {
+	keys  []string
+	apply Applier
+}
+
+func (r *reloader) match(key string) bool {
+	for _, k := range r.keys {
+		if k == key || (strings.HasSuffix(k, ".") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnReload 注册可以在运行时生效的配置项，key以.结尾时匹配该前缀的所有key
+func (a *App) OnReload(apply Applier, keys ...string) {
+	a.reloadMutex.Lock()
+	defer a.reloadMutex.Unlock()
+
+	a.reloaders = append(a.reloaders, &reloader{keys: keys, apply: apply})
+}
+
+// ReloadReport Restart中的key保持旧值，Failed为应用失败的组件
+type ReloadReport = adminapi.ReloadReport
+
+// Reload 重新加载配置文件，应用可以在运行时生效的变更，由SIGHUP和管理接口触发
+func (a *App) Reload() (*ReloadReport, error) {
+	a.reloadMutex.Lock()
+	defer a.reloadMutex.Unlock()
+
+	result, err := LoadConfig(a.configOption)
+	if err != nil {
+		return nil, err
+	}
+
+	running, err := config.Flatten(a.Config())
+	if err != nil {
+		return nil, err
+	}
+
+	c := result.Config
+	loaded, err := config.Flatten(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		report  = &ReloadReport{}
+		changed = config.Changed(running, loaded)
+		handled = make(map[string]bool, len(changed))
+	)
+
+	for _, r := range a.reloaders {
+		var keys []string
+		for _, key := range changed {
+			if r.match(key) {
+				keys = append(keys, key)
+				handled[key] = true
+			}
+		}
+
+		if len(keys) == 0 {
+			continue
+		}
+
+		switch err = r.apply(c); {
+		case err == nil:
+			report.Applied = append(report.Applied, keys...)
+			for _, key := range keys {
+				if value, exists := loaded[key]; exists {
+					running[key] = value
+				} else {
+					delete(running, key)
+				}
+			}
+		case errors.Is(err, ErrRestartRequired):
+			report.Restart = append(report.Restart, keys...)
+		default:
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", strings.Join(keys, ","), err))
+		}
+	}
+
+	for _, key := range changed {
+		if !handled[key] {
+			report.Restart = append(report.Restart, key)
+		}
+	}
+
+	// 运行中的配置只包含已生效的变更，需要重启的key下次reload时仍会报告
+	effective, err := config.Build(running)
+	if err != nil {
+		return nil, err
+	}
+	a.conf.Store(effective)
+	a.secretKeys.Store(result.SecretKeys)
+
+	fields := []zap.Field{
+		zaplogger.Event("reload"),
+		zap.Strings("Applied", report.Applied),
+		zap.Strings("Restart", report.Restart),
+		zap.Strings("Failed", report.Failed),
+	}
+
+	if len(report.Restart) > 0 || len(report.Failed) > 0 {
+		a.Logger.Warn("config reloaded, some changes not applied", fields...)
+	} else {
+		a.Logger.Info("config reloaded", fields...)
+	}
+	return report, nil
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"event/core/ratelimit"
+	"event/core/server"
+	"event/core/zapkey"
+
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+	"go.uber.org/zap"
+)
+
+// connLimiter 记录创建时的配置，配置更新后重新创建
+type connLimiter struct {
+	opt *ratelimit.Option
+	*ratelimit.Limiter
+}
+
+// WithRateLimit 开启连接入站限流，分片按分片事件检查，重组后再按原始事件检查，可以在运行时更新
+func (r *Route) WithRateLimit(opt ratelimit.Option) {
+	r.limitOpt.Store(&opt)
+}
+
+// RateLimit 当前的限流配置，未开启时为nil
+func (r *Route) RateLimit() *ratelimit.Option {
+	opt, _ := r.limitOpt.Load().(*ratelimit.Option)
+	return opt
+}
+
+func (r *Route) limiter(conn *server.Conn, opt *ratelimit.Option) *ratelimit.Limiter {
+	if value, exists := conn.Get(limiterKey); exists && value.(*connLimiter).opt == opt {
+		return value.(*connLimiter).Limiter
+	}
+
+	limiter := ratelimit.NewLimiter(*opt)
+	conn.Set(limiterKey, &connLimiter{opt: opt, Limiter: limiter})
+	return limiter
+}
+
+// allow 返回false时消息已按惩罚策略处理，不再分发，delay大于0时需要延迟分发
+func (r *Route) allow(conn *server.Conn, pkg *base.Package) (delay time.Duration, ok bool) {
+	opt := r.RateLimit()
+	if opt == nil {
+		return 0, true
+	}
+
+	limiter := r.limiter(conn, opt)
+
+	result := limiter.Allow(pkg.Id, time.Now())
+	if result.Allowed {
+		return result.Delay, true
+	}
+
+	conn.Metrics().Drop(server.DropRateLimited)
+	conn.Logger().Warn("rate limited",
+		zaplogger.Event("ratelimit"),
+		zapkey.EventId(pkg.Id),
+		zap.String("Penalty", string(result.Penalty)),
+		zap.Int("Violations", limiter.Violations()),
+	)
+
+	if result.Disconnect {
+		conn.CloseWithStatus(ws.StatusPolicyViolation, "rate limited")
+		return 0, false
+	}
+
+	if result.Penalty == ratelimit.PenaltyError {
+		_ = conn.Emit(&base.Package{
+			Id:   base.EventError,
+			Name: "rate limited",
+			Param: base.JsonParam{
+				"event": pkg.Id,
+				"msg":   "rate limited",
+				"code":  http.StatusTooManyRequests,
+			},
+		})
+	}
+
+	return 0, false
+}
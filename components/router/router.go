@@ -1,16 +1,35 @@
 package router
 
 import (
+	"context"
+	"time"
+
+	"event/core/chunk"
 	"event/core/server"
+	"event/core/tracing"
 	"event/core/zapkey"
+
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
 	"github.com/grpc-boot/base"
 	"github.com/grpc-boot/base/core/zaplogger"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
+)
+
+const (
+	assemblerKey = "router:assembler"
+	limiterKey   = "router:limiter"
 )
 
 type EventHandler func(conn *server.Conn, pkg *base.Package) error
 
+type ChunkProgress func(conn *server.Conn, transferId string, eventId uint16, done, size int)
+
 type Route struct {
-	handlers map[uint16][]EventHandler
+	handlers      map[uint16][]EventHandler
+	chunkOpt      *chunk.Option
+	chunkProgress ChunkProgress
+	limitOpt      atomic.Value
 }
 
 func NewRouter() *Route {
@@ -28,7 +47,53 @@ func (r *Route) On(eventId uint16, handlers ...EventHandler) {
 	r.handlers[eventId] = append(r.handlers[eventId], handlers...)
 }
 
-func (r *Route) trigger(conn *server.Conn, pkg *base.Package) error {
+// Handles 事件id是否有处理器，开启分片时包含分片事件
+func (r *Route) Handles(eventId uint16) bool {
+	if eventId == chunk.EventChunk && r.chunkOpt != nil {
+		return true
+	}
+
+	_, exists := r.handlers[eventId]
+	return exists
+}
+
+// Events 已注册的事件id及各自的处理器数量
+func (r *Route) Events() map[uint16]int {
+	events := make(map[uint16]int, len(r.handlers))
+	for eventId, handlers := range r.handlers {
+		events[eventId] = len(handlers)
+	}
+	return events
+}
+
+// WithChunk 开启分片包重组，重组完成后按原始事件id分发
+func (r *Route) WithChunk(opt chunk.Option, progress ChunkProgress) {
+	r.chunkOpt = &opt
+	r.chunkProgress = progress
+}
+
+func (r *Route) assembler(conn *server.Conn) *chunk.Assembler {
+	if value, exists := conn.Get(assemblerKey); exists {
+		return value.(*chunk.Assembler)
+	}
+
+	var progress chunk.Progress
+	if r.chunkProgress != nil {
+		progress = func(transferId string, eventId uint16, done, size int) {
+			r.chunkProgress(conn, transferId, eventId, done, size)
+		}
+	}
+
+	// 合并后的包同样受入站消息的param限制
+	opt := *r.chunkOpt
+	opt.Check = conn.CheckPackage
+
+	assembler := chunk.NewAssembler(opt, progress)
+	conn.Set(assemblerKey, assembler)
+	return assembler
+}
+
+func (r *Route) trigger(ctx context.Context, conn *server.Conn, pkg *base.Package) error {
 	if pkg == nil {
 		return nil
 	}
@@ -37,9 +102,16 @@ func (r *Route) trigger(conn *server.Conn, pkg *base.Package) error {
 
 	if handlers, exists := r.handlers[pkg.Id]; exists {
 		for index, _ := range handlers {
-			if er := handlers[index](conn, pkg); er != nil {
+			start := time.Now()
+			span, traced := traceHandler(ctx, conn, pkg, index)
+			er := handlers[index](conn, pkg)
+			if er != nil {
 				err = er
 			}
+			if traced {
+				tracing.End(span, er)
+			}
+			conn.Metrics().ObserveHandler(pkg.Id, time.Since(start))
 		}
 	}
 
@@ -47,43 +119,97 @@ func (r *Route) trigger(conn *server.Conn, pkg *base.Package) error {
 }
 
 func (r *Route) ConnectHandle(conn *server.Conn) error {
-	base.Debug("connect create",
+	conn.Logger().Debug("connect create",
 		zaplogger.Event("connect"),
-		zapkey.Address(conn.PeerAddr()),
 	)
 
-	return r.trigger(conn, &base.Package{
+	return r.trigger(context.Background(), conn, &base.Package{
 		Id:    base.EventConnectSuccess,
 		Name:  "connect success",
 		Param: nil,
 	})
 }
 
-func (r *Route) Handle(conn *server.Conn, data []byte) error {
-	base.Debug("got new msg",
-		zaplogger.Data(data),
-		zaplogger.Event("message"),
-	)
-
-	if base.Bytes2String(data) == "ping" {
+func (r *Route) Handle(conn *server.Conn, messageType ws.MessageType, data []byte) error {
+	if messageType == ws.MessageText && base.Bytes2String(data) == "ping" {
 		return conn.SendText([]byte("pong"))
 	}
 
+	start := time.Now()
 	pkg, err := conn.Unpack(data)
+
+	ctx := context.Background()
+	if conn.Tracer().Enabled() {
+		var span trace.Span
+		ctx, span = traceMessage(conn, pkg, start, time.Now(), err)
+		defer func() {
+			tracing.End(span, err)
+		}()
+	}
+
 	if err != nil {
-		base.Error("unpack msg failed",
+		conn.Logger().Error("unpack msg failed",
 			zaplogger.Error(err),
-			zaplogger.Value(data),
+			zapkey.Size(len(data)),
 		)
 
 		return err
 	}
 
-	err = r.trigger(conn, pkg)
+	// param按logger的redact配置打码，日志量由采样控制
+	conn.Logger().Debug("got new msg",
+		zaplogger.Event("message"),
+		zapkey.EventId(pkg.Id),
+		zapkey.Size(len(data)),
+		zapkey.Param(pkg.Param),
+	)
+
+	delay, ok := r.allow(conn, pkg)
+	if !ok {
+		return nil
+	}
+
+	// 分片在event loop中重组，限流器只在event loop中使用，节流的goroutine只负责分发
+	if pkg.Id == chunk.EventChunk && r.chunkOpt != nil {
+		if pkg, err = r.assemble(conn, pkg); err != nil || pkg == nil {
+			return err
+		}
+
+		// 重组后的消息按原始事件id再检查一次，分片不能绕过事件的限流
+		assembled, ok := r.allow(conn, pkg)
+		if !ok {
+			return nil
+		}
+
+		if assembled > delay {
+			delay = assembled
+		}
+	}
+
+	err = r.schedule(conn, delay, func() error {
+		return r.dispatch(ctx, conn, pkg)
+	})
+	return err
+}
+
+// assemble 分片未收齐时返回nil
+func (r *Route) assemble(conn *server.Conn, pkg *base.Package) (*base.Package, error) {
+	pkg, err := r.assembler(conn).Add(pkg)
 	if err != nil {
-		base.Error("handler error",
+		conn.Logger().Error("assemble chunk failed",
 			zaplogger.Error(err),
-			zaplogger.Value(pkg),
+			zaplogger.Event("chunk"),
+		)
+	}
+	return pkg, err
+}
+
+func (r *Route) dispatch(ctx context.Context, conn *server.Conn, pkg *base.Package) error {
+	err := r.trigger(ctx, conn, pkg)
+	if err != nil {
+		conn.Logger().Error("handler error",
+			zaplogger.Error(err),
+			zapkey.Package(pkg),
 		)
 	}
 
@@ -91,14 +217,16 @@ func (r *Route) Handle(conn *server.Conn, data []byte) error {
 }
 
 func (r *Route) CloseHandle(conn *server.Conn) error {
-	base.Debug("connect close",
+	conn.Logger().Debug("connect close",
 		zaplogger.Event("close"),
-		zapkey.Address(conn.PeerAddr()),
 	)
 
-	return r.trigger(conn, &base.Package{
-		Id:    base.EventClose,
-		Name:  "close",
-		Param: nil,
+	// 节流队列中还有消息时在这些消息之后执行，处理器不会与关闭并发
+	return r.closed(conn, func() error {
+		return r.trigger(context.Background(), conn, &base.Package{
+			Id:    base.EventClose,
+			Name:  "close",
+			Param: nil,
+		})
 	})
 }
@@ -0,0 +1,279 @@
+package router_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"event/components/client"
+	"event/components/router"
+	"event/core/chunk"
+	"event/core/protocol"
+	"event/core/ratelimit"
+	"event/core/server"
+
+	"github.com/grpc-boot/base"
+)
+
+var (
+	aes, _ = base.NewAes("SD3c523asz7*&^df", "312c45cDvd4bFc12")
+)
+
+func echo(conn *server.Conn, pkg *base.Package) error {
+	return conn.Emit(pkg)
+}
+
+func start(t *testing.T, addr string, r *router.Route) *server.Server {
+	ring, err := protocol.NewKeyRing("", protocol.AesKey{Key: "SD3c523asz7*&^df312c45cDvd4bFc12"})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	s, err := server.New(server.Option{
+		Addr:      addr,
+		NumLoops:  1,
+		Handshake: server.NewHandshake(protocol.NewAcceptWithKeyRing(ring, 0)),
+		Handler:   r,
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	go s.Start()
+	return s
+}
+
+func dial(t *testing.T, addr string) (*client.Client, chan *base.Package) {
+	c, err := client.NewClient("ws://"+addr+"/ws", base.LevelV1, aes)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	received := make(chan *base.Package, 16)
+	c.OnPackage(func(pkg *base.Package) {
+		received <- pkg
+	})
+
+	if err = c.Dial(time.Second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+	return c, received
+}
+
+func receive(t *testing.T, received chan *base.Package) *base.Package {
+	select {
+	case pkg := <-received:
+		return pkg
+	case <-time.After(time.Second * 3):
+		t.Fatalf("want package, got timeout")
+	}
+	return nil
+}
+
+func TestRoute_Throttle(t *testing.T) {
+	r := router.NewRouter()
+	r.On(0x0300, echo)
+	r.WithRateLimit(ratelimit.Option{Rate: 10, Burst: 1, Penalty: ratelimit.PenaltyThrottle, MaxDelay: time.Second})
+
+	s := start(t, "127.0.0.1:3348", r)
+	defer s.Shutdown(time.Second)
+
+	throttled, slow := dial(t, "127.0.0.1:3348")
+	defer throttled.Close()
+
+	other, fast := dial(t, "127.0.0.1:3348")
+	defer other.Close()
+
+	begin := time.Now()
+	for index := 0; index < 4; index++ {
+		if err := throttled.SendMsg(&base.Package{Id: 0x0300, Name: "message", Param: base.JsonParam{"index": index}}); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+	}
+
+	// 节流不阻塞同一个event loop上的其他连接
+	if err := other.SendMsg(&base.Package{Id: 0x0300, Name: "message"}); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	receive(t, fast)
+	if elapsed := time.Since(begin); elapsed > time.Millisecond*150 {
+		t.Fatalf("want other conn served within 150ms, got %s", elapsed)
+	}
+
+	for index := 0; index < 4; index++ {
+		if got := receive(t, slow).Param.Int("index"); got != index {
+			t.Fatalf("want index %d, got %d", index, got)
+		}
+	}
+
+	if elapsed := time.Since(begin); elapsed < time.Millisecond*250 {
+		t.Fatalf("want throttled for at least 250ms, got %s", elapsed)
+	}
+}
+
+func TestRoute_Penalty(t *testing.T) {
+	tests := []struct {
+		penalty ratelimit.Penalty
+		addr    string
+	}{
+		{ratelimit.PenaltyDrop, "127.0.0.1:3349"},
+		{ratelimit.PenaltyError, "127.0.0.1:3350"},
+		{ratelimit.PenaltyDisconnect, "127.0.0.1:3351"},
+	}
+
+	for _, tt := range tests {
+		r := router.NewRouter()
+		r.On(0x0300, echo)
+		r.WithRateLimit(ratelimit.Option{
+			Events:  map[uint16]ratelimit.EventLimit{0x0300: {Rate: 1, Burst: 1}},
+			Penalty: tt.penalty,
+		})
+
+		s := start(t, tt.addr, r)
+		c, received := dial(t, tt.addr)
+
+		for index := 0; index < 2; index++ {
+			if err := c.SendMsg(&base.Package{Id: 0x0300, Name: "message"}); err != nil {
+				t.Fatalf("want nil, got %s", err)
+			}
+		}
+
+		if pkg := receive(t, received); pkg.Id != 0x0300 {
+			t.Fatalf("want echo, got %+v", pkg)
+		}
+
+		switch tt.penalty {
+		case ratelimit.PenaltyDrop:
+			select {
+			case pkg := <-received:
+				t.Fatalf("want dropped, got %+v", pkg)
+			case <-time.After(time.Millisecond * 300):
+			}
+		case ratelimit.PenaltyError:
+			pkg := receive(t, received)
+			if pkg.Id != base.EventError || pkg.Param.Int("code") != http.StatusTooManyRequests {
+				t.Fatalf("want error %d, got %+v", http.StatusTooManyRequests, pkg)
+			}
+		case ratelimit.PenaltyDisconnect:
+			for index := 0; s.TotalConns() != 0; index++ {
+				if index > 30 {
+					t.Fatalf("want disconnected, got %d conns", s.TotalConns())
+				}
+				time.Sleep(time.Millisecond * 50)
+			}
+		}
+
+		c.Close()
+		s.Shutdown(time.Second)
+	}
+}
+
+func TestRoute_ChunkRateLimit(t *testing.T) {
+	r := router.NewRouter()
+	r.On(0x0300, echo)
+	r.WithChunk(chunk.Option{}, nil)
+	r.WithRateLimit(ratelimit.Option{
+		Events: map[uint16]ratelimit.EventLimit{
+			0x0300:           {Rate: 1, Burst: 1},
+			chunk.EventChunk: {Rate: 500, Burst: 1000, Cost: 0.1},
+		},
+		Penalty: ratelimit.PenaltyDrop,
+	})
+
+	s := start(t, "127.0.0.1:3352", r)
+	defer s.Shutdown(time.Second)
+
+	c, received := dial(t, "127.0.0.1:3352")
+	defer c.Close()
+
+	c.WithChunk(chunk.Option{ChunkSize: chunk.MinChunkSize}, nil)
+
+	data := strings.Repeat("0123456789", 400)
+	for index := 0; index < 2; index++ {
+		if err := c.SendChunked(&base.Package{Id: 0x0300, Name: "message", Param: base.JsonParam{"data": data}}, nil); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+	}
+
+	if got := receive(t, received).Param.String("data"); got != data {
+		t.Fatalf("want %d bytes, got %d", len(data), len(got))
+	}
+
+	// 分片本身没有超限，重组后的0x0300超限
+	select {
+	case pkg := <-received:
+		t.Fatalf("want dropped, got %+v", pkg)
+	case <-time.After(time.Millisecond * 300):
+	}
+}
+
+// 节流与分片同时开启，go test -race检查限流器、重组和关闭不会并发执行
+func TestRoute_ChunkThrottle(t *testing.T) {
+	var (
+		seen   []string
+		closed = make(chan struct{})
+	)
+
+	r := router.NewRouter()
+	r.On(0x0300, func(conn *server.Conn, pkg *base.Package) error {
+		seen = append(seen, pkg.Name)
+		return conn.Emit(pkg)
+	})
+	r.On(base.EventClose, func(conn *server.Conn, pkg *base.Package) error {
+		seen = append(seen, pkg.Name)
+		close(closed)
+		return nil
+	})
+	r.WithChunk(chunk.Option{}, nil)
+	r.WithRateLimit(ratelimit.Option{
+		Rate:     20,
+		Burst:    1,
+		Events:   map[uint16]ratelimit.EventLimit{chunk.EventChunk: {Rate: 500, Burst: 1000, Cost: 0.01}},
+		Penalty:  ratelimit.PenaltyThrottle,
+		MaxDelay: time.Second * 2,
+	})
+
+	s := start(t, "127.0.0.1:3353", r)
+	defer s.Shutdown(time.Second)
+
+	c, received := dial(t, "127.0.0.1:3353")
+	c.WithChunk(chunk.Option{ChunkSize: chunk.MinChunkSize}, nil)
+
+	data := strings.Repeat("0123456789", 400)
+	for index := 0; index < 3; index++ {
+		if err := c.SendChunked(&base.Package{Id: 0x0300, Name: "chunked", Param: base.JsonParam{"index": index * 2, "data": data}}, nil); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		if err := c.SendMsg(&base.Package{Id: 0x0300, Name: "message", Param: base.JsonParam{"index": index*2 + 1}}); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+	}
+
+	for index := 0; index < 6; index++ {
+		if got := receive(t, received).Param.Int("index"); got != index {
+			t.Fatalf("want index %d, got %d", index, got)
+		}
+	}
+
+	// 关闭时队列中还有节流的消息
+	for index := 0; index < 3; index++ {
+		if err := c.SendChunked(&base.Package{Id: 0x0300, Name: "chunked", Param: base.JsonParam{"data": data}}, nil); err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+	}
+	time.Sleep(time.Millisecond * 20)
+	c.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 3):
+		t.Fatalf("want close, got timeout")
+	}
+
+	if last := seen[len(seen)-1]; last != "close" {
+		t.Fatalf("want close last, got %v", seen)
+	}
+}
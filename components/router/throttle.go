@@ -0,0 +1,111 @@
+package router
+
+import (
+	"sync"
+	"time"
+
+	"event/core/server"
+)
+
+const (
+	throttleKey = "router:throttle"
+)
+
+type throttled struct {
+	at       time.Time
+	dispatch func() error
+}
+
+// throttle 节流的消息不在event loop中等待，由单独的goroutine按到达顺序延迟分发，
+// 队列非空时后续消息也进入队列，同一连接的处理器不会并发执行
+type throttle struct {
+	mutex   sync.Mutex
+	queue   []throttled
+	active  bool
+	onClose func() error
+}
+
+func (r *Route) throttle(conn *server.Conn) *throttle {
+	if value, exists := conn.Get(throttleKey); exists {
+		return value.(*throttle)
+	}
+
+	t := &throttle{}
+	conn.Set(throttleKey, t)
+	return t
+}
+
+// schedule 没有节流过的连接不创建队列，直接分发
+func (r *Route) schedule(conn *server.Conn, delay time.Duration, dispatch func() error) error {
+	if delay <= 0 {
+		if _, exists := conn.Get(throttleKey); !exists {
+			return dispatch()
+		}
+	}
+	return r.throttle(conn).run(conn, delay, dispatch)
+}
+
+// closed 没有正在分发的队列时直接执行onClose，否则由drain在退出前执行
+func (r *Route) closed(conn *server.Conn, onClose func() error) error {
+	value, exists := conn.Get(throttleKey)
+	if !exists {
+		return onClose()
+	}
+
+	t := value.(*throttle)
+	t.mutex.Lock()
+	if !t.active {
+		t.mutex.Unlock()
+		return onClose()
+	}
+
+	t.onClose = onClose
+	t.mutex.Unlock()
+	return nil
+}
+
+// run delay为0且队列为空时直接在当前goroutine中分发并返回错误，进入队列时返回nil，错误由dispatch自己记录
+func (t *throttle) run(conn *server.Conn, delay time.Duration, dispatch func() error) error {
+	t.mutex.Lock()
+	if delay <= 0 && !t.active {
+		t.mutex.Unlock()
+		return dispatch()
+	}
+
+	t.queue = append(t.queue, throttled{at: time.Now().Add(delay), dispatch: dispatch})
+	if t.active {
+		t.mutex.Unlock()
+		return nil
+	}
+
+	t.active = true
+	t.mutex.Unlock()
+
+	go t.drain(conn)
+	return nil
+}
+
+func (t *throttle) drain(conn *server.Conn) {
+	for {
+		t.mutex.Lock()
+		if len(t.queue) == 0 || !conn.Connected() {
+			onClose := t.onClose
+			t.queue, t.active, t.onClose = nil, false, nil
+			t.mutex.Unlock()
+
+			if onClose != nil {
+				_ = onClose()
+			}
+			return
+		}
+
+		item := t.queue[0]
+		t.queue = t.queue[1:]
+		t.mutex.Unlock()
+
+		if wait := time.Until(item.at); wait > 0 {
+			time.Sleep(wait)
+		}
+		_ = item.dispatch()
+	}
+}
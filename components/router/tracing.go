@@ -0,0 +1,47 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"event/core/server"
+	"event/core/tracing"
+
+	"github.com/grpc-boot/base"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceMessage 解包后才能拿到客户端的trace context，所以message和unpack span都用记录的时间补建
+func traceMessage(conn *server.Conn, pkg *base.Package, start, unpacked time.Time, err error) (context.Context, trace.Span) {
+	ctx := context.Background()
+	attrs := []attribute.KeyValue{server.ConnAttr(conn.Connection)}
+	if pkg != nil {
+		ctx = tracing.Extract(ctx, pkg.Param)
+		attrs = append(attrs, server.EventAttr(pkg.Id))
+	}
+
+	ctx, span := conn.Tracer().Start(ctx, "event.message", start, trace.SpanKindConsumer, attrs...)
+
+	_, unpack := conn.Tracer().Start(ctx, "event.unpack", start, trace.SpanKindInternal)
+	if err != nil {
+		unpack.RecordError(err)
+	}
+	unpack.End(trace.WithTimestamp(unpacked))
+
+	return ctx, span
+}
+
+// traceHandler 每个处理器一个span，并把trace context写回pkg，处理器原样回复或者转发时客户端可以继续关联
+func traceHandler(ctx context.Context, conn *server.Conn, pkg *base.Package, index int) (trace.Span, bool) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil, false
+	}
+
+	ctx, span := conn.Tracer().Start(ctx, "event.handler", time.Time{}, trace.SpanKindInternal,
+		server.EventAttr(pkg.Id),
+		attribute.Int("handler.index", index),
+	)
+	pkg.Param = tracing.Inject(ctx, pkg.Param)
+	return span, true
+}
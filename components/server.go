@@ -0,0 +1,110 @@
+package components
+
+import (
+	"time"
+
+	"event/core/metrics"
+	"event/core/server"
+	"event/core/tracing"
+
+	"github.com/grpc-boot/base"
+)
+
+const (
+	shutdownTimeout = time.Second * 10
+)
+
+// serverComponent Start时在后台运行event loop
+type serverComponent struct {
+	app *App
+}
+
+func (sc *serverComponent) Name() string {
+	return ComponentServer
+}
+
+func (sc *serverComponent) DependsOn() []string {
+	return []string{ComponentHandshake, ComponentRouter, ComponentMetrics, ComponentTracing}
+}
+
+func (sc *serverComponent) Init(app *App) (err error) {
+	sc.app = app
+	app.Server, err = NewServer(app.Config(), app.Handshake, app.Router, app.Logger, app.Metrics, app.Tracer)
+	if err != nil {
+		return err
+	}
+
+	s := app.Server
+	app.OnReload(func(c *base.Config) error {
+		s.Admission().Update(admissionOption(c.Params))
+		return nil
+	}, "admission.maxConns", "admission.maxMemoryMB", "admission.maxLagMs")
+
+	// 心跳超时由Server检查，不使用gev.IdleTime，以便运行时更新
+	app.OnReload(func(c *base.Config) error {
+		s.WithIdleTimeout(idleTimeout(c.Params))
+		return nil
+	}, "maxIdleSeconds")
+	return nil
+}
+
+func (sc *serverComponent) Start() error {
+	go sc.app.Server.Start()
+	return nil
+}
+
+func (sc *serverComponent) Stop() error {
+	return sc.app.Server.Shutdown(shutdownTimeout)
+}
+
+// NewServer 按配置创建Server，返回时已开始监听，registry为nil时不统计指标，tracer为nil时不创建span
+func NewServer(c *base.Config, handshake *server.Handshake, handler server.Handler, logger server.Logger, registry *metrics.Registry, tracer *tracing.Tracer) (*server.Server, error) {
+	return server.New(server.Option{
+		Addr:      c.Addr,
+		NumLoops:  c.Params.Int("numLoops"),
+		Handshake: handshake,
+		Handler:   handler,
+		Logger:    logger,
+		Metrics:   registry,
+		Tracer:    tracer,
+		Compression: server.NewCompression(server.DeflateOption{
+			Enable:                  c.Params["compress.enable"] == true,
+			Level:                   c.Params.Int("compress.level"),
+			MinSize:                 c.Params.Int("compress.minSize"),
+			ServerNoContextTakeover: c.Params["compress.serverNoContextTakeover"] == true,
+			ClientNoContextTakeover: c.Params["compress.clientNoContextTakeover"] == true,
+		}),
+		Limit: server.MessageLimit{
+			MaxFrameSize:     c.Params.Int("message.maxFrameSize"),
+			MaxMessageSize:   c.Params.Int("message.maxSize"),
+			MaxParamSize:     c.Params.Int("message.maxParamSize"),
+			MaxDepth:         c.Params.Int("message.maxDepth"),
+			MaxAssembledSize: c.Params.Int("message.maxAssembledSize"),
+		},
+		IdleTimeout: idleTimeout(c.Params),
+		Admission:   admissionOption(c.Params),
+		TLS: server.TLSOption{
+			Enable:         c.Params["tls.enable"] == true,
+			Addr:           c.Addr,
+			BackendAddr:    c.Params.String("tls.backendAddr"),
+			CertFile:       c.Params.String("tls.certFile"),
+			KeyFile:        c.Params.String("tls.keyFile"),
+			ClientCaFile:   c.Params.String("tls.clientCaFile"),
+			ClientAuth:     c.Params.String("tls.clientAuth"),
+			ReloadInterval: time.Second * time.Duration(c.Params.Int64("tls.reloadSeconds")),
+		},
+	})
+}
+
+func admissionOption(params base.JsonParam) server.AdmissionOption {
+	return server.AdmissionOption{
+		MaxConns:       params.Int64("admission.maxConns"),
+		MaxMemory:      uint64(params.Int64("admission.maxMemoryMB")) << 20,
+		MaxLag:         time.Millisecond * time.Duration(params.Int64("admission.maxLagMs")),
+		SampleInterval: time.Millisecond * time.Duration(params.Int64("admission.sampleMs")),
+	}
+}
+
+func idleTimeout(params base.JsonParam) time.Duration {
+	return time.Second * time.Duration(params.Int64("maxIdleSeconds"))
+}
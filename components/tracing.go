@@ -0,0 +1,51 @@
+package components
+
+import (
+	"context"
+
+	"event/core/tracing"
+)
+
+// tracingComponent 按trace.exporter创建App的Tracer，为空时不开启
+type tracingComponent struct {
+	app *App
+}
+
+func (tc *tracingComponent) Name() string {
+	return ComponentTracing
+}
+
+func (tc *tracingComponent) DependsOn() []string {
+	return []string{ComponentLogger}
+}
+
+func (tc *tracingComponent) Init(app *App) (err error) {
+	conf := app.Config()
+	params := conf.Params
+
+	ratio := 1.0
+	if _, exists := params["trace.sampleRatio"]; exists {
+		ratio = params.Float64("trace.sampleRatio")
+	}
+
+	tc.app = app
+	app.Tracer, err = tracing.New(tracing.Option{
+		Exporter:    params.String("trace.exporter"),
+		Endpoint:    params.String("trace.endpoint"),
+		Insecure:    params["trace.insecure"] == true,
+		SampleRatio: ratio,
+		Service:     conf.Name,
+		Version:     conf.Ver,
+	})
+	return err
+}
+
+func (tc *tracingComponent) Start() error {
+	return nil
+}
+
+func (tc *tracingComponent) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return tc.app.Tracer.Shutdown(ctx)
+}
@@ -0,0 +1,343 @@
+package chunk
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grpc-boot/base"
+)
+
+const (
+	// EventChunk 分片包事件id，原始包按json打包后分片放在param中，
+	// 在events/events.json中登记，core不能依赖events，修改时两处保持一致
+	EventChunk = 0x0104
+)
+
+const (
+	MinChunkSize        = 1024
+	DefaultChunkSize    = 64 * 1024
+	DefaultMaxSize      = 16 * 1024 * 1024
+	DefaultMaxTransfers = 4
+	DefaultTimeout      = time.Second * 30
+)
+
+var (
+	ErrChunkFormat      = errors.New("chunk: invalid chunk format")
+	ErrChunkTooLarge    = errors.New("chunk: transfer too large")
+	ErrChunkChecksum    = errors.New("chunk: checksum mismatch")
+	ErrTooManyTransfers = errors.New("chunk: too many transfers")
+)
+
+type Option struct {
+	ChunkSize    int
+	MaxSize      int
+	MaxTransfers int
+	Timeout      time.Duration
+	// Check 合并后解码之前检查原始数据，返回错误时丢弃该传输
+	Check func(data []byte) error
+}
+
+func (opt *Option) init() {
+	opt.ChunkSize = normalizeSize(opt.ChunkSize)
+
+	if opt.MaxSize < 1 {
+		opt.MaxSize = DefaultMaxSize
+	}
+
+	if opt.MaxTransfers < 1 {
+		opt.MaxTransfers = DefaultMaxTransfers
+	}
+
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultTimeout
+	}
+}
+
+func normalizeSize(chunkSize int) int {
+	if chunkSize < 1 {
+		return DefaultChunkSize
+	}
+
+	if chunkSize < MinChunkSize {
+		return MinChunkSize
+	}
+	return chunkSize
+}
+
+// Progress 传输进度，done为已发送或已接收的字节数
+type Progress func(transferId string, eventId uint16, done, size int)
+
+// Split 将pkg拆分为多个分片包，不超过chunkSize时原样返回
+func Split(pkg *base.Package, chunkSize int) []*base.Package {
+	chunkSize = normalizeSize(chunkSize)
+
+	data := pkg.Pack()
+	if len(data) <= chunkSize {
+		return []*base.Package{pkg}
+	}
+
+	var (
+		sum        = sha256.Sum256(data)
+		checksum   = hex.EncodeToString(sum[:])
+		transferId = hex.EncodeToString(base.RandBytes(8))
+		total      = (len(data) + chunkSize - 1) / chunkSize
+		chunks     = make([]*base.Package, 0, total)
+	)
+
+	for seq := 0; seq < total; seq++ {
+		end := (seq + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunks = append(chunks, &base.Package{
+			Id:   EventChunk,
+			Name: "chunk",
+			Param: base.JsonParam{
+				"tid":   transferId,
+				"event": pkg.Id,
+				"seq":   seq,
+				"total": total,
+				"size":  len(data),
+				"sum":   checksum,
+				"data":  base64.StdEncoding.EncodeToString(data[seq*chunkSize : end]),
+			},
+		})
+	}
+
+	return chunks
+}
+
+// Send 拆分并逐个发送，progress可为nil
+func Send(pkg *base.Package, chunkSize int, emit func(pkg *base.Package) error, progress Progress) error {
+	chunkSize = normalizeSize(chunkSize)
+
+	chunks := Split(pkg, chunkSize)
+	if len(chunks) == 1 {
+		return emit(pkg)
+	}
+
+	var (
+		transferId = chunks[0].Param.String("tid")
+		size, _    = chunks[0].Param["size"].(int)
+	)
+
+	for index, c := range chunks {
+		if err := emit(c); err != nil {
+			return err
+		}
+
+		if progress != nil {
+			done := (index + 1) * chunkSize
+			if done > size {
+				done = size
+			}
+			progress(transferId, pkg.Id, done, size)
+		}
+	}
+
+	return nil
+}
+
+type transfer struct {
+	eventId  uint16
+	total    int
+	size     int
+	checksum string
+	parts    [][]byte
+	received int
+	bytes    int
+	deadline time.Time
+}
+
+// Assembler 重组分片包，每个连接一个实例，有未完成的传输时由定时器清理超时的传输
+type Assembler struct {
+	mutex     sync.Mutex
+	opt       Option
+	progress  Progress
+	transfers map[string]*transfer
+	timer     *time.Timer
+	scheduled bool
+}
+
+func NewAssembler(opt Option, progress Progress) *Assembler {
+	opt.init()
+
+	return &Assembler{
+		opt:       opt,
+		progress:  progress,
+		transfers: make(map[string]*transfer),
+	}
+}
+
+// Add 添加一个分片，全部分片到达并校验通过后返回原始包，否则返回nil
+func (a *Assembler) Add(pkg *base.Package) (full *base.Package, err error) {
+	if pkg == nil || pkg.Id != EventChunk || pkg.Param == nil {
+		return nil, ErrChunkFormat
+	}
+
+	var (
+		transferId = pkg.Param.String("tid")
+		seq        = pkg.Param.Int("seq")
+		total      = pkg.Param.Int("total")
+		size       = pkg.Param.Int("size")
+		eventId    = pkg.Param.Int("event")
+	)
+
+	if transferId == "" || total < 1 || seq < 0 || seq >= total || size < 1 || eventId < 1 || eventId > 0xffff {
+		return nil, ErrChunkFormat
+	}
+
+	if size > a.opt.MaxSize {
+		return nil, ErrChunkTooLarge
+	}
+
+	// 分片不小于MinChunkSize，限制total避免分配过大的切片
+	if total > (size+MinChunkSize-1)/MinChunkSize {
+		return nil, ErrChunkFormat
+	}
+
+	data, err := base64.StdEncoding.DecodeString(pkg.Param.String("data"))
+	if err != nil {
+		return nil, ErrChunkFormat
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	a.expire(now)
+
+	t, exists := a.transfers[transferId]
+	if !exists {
+		if len(a.transfers) >= a.opt.MaxTransfers {
+			return nil, ErrTooManyTransfers
+		}
+
+		t = &transfer{
+			eventId:  uint16(eventId),
+			total:    total,
+			size:     size,
+			checksum: pkg.Param.String("sum"),
+			parts:    make([][]byte, total),
+			deadline: now.Add(a.opt.Timeout),
+		}
+		a.transfers[transferId] = t
+		a.schedule(a.opt.Timeout)
+	}
+
+	if t.total != total || t.size != size || t.eventId != uint16(eventId) {
+		delete(a.transfers, transferId)
+		return nil, ErrChunkFormat
+	}
+
+	if t.parts[seq] == nil {
+		if t.bytes+len(data) > t.size {
+			delete(a.transfers, transferId)
+			return nil, ErrChunkTooLarge
+		}
+
+		t.parts[seq] = data
+		t.received++
+		t.bytes += len(data)
+
+		if a.progress != nil {
+			a.progress(transferId, t.eventId, t.bytes, t.size)
+		}
+	}
+
+	if t.received < t.total {
+		return nil, nil
+	}
+
+	delete(a.transfers, transferId)
+	return t.assemble(a.opt.Check)
+}
+
+// Pending 未完成的传输数量
+func (a *Assembler) Pending() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.expire(time.Now())
+	return len(a.transfers)
+}
+
+// schedule 已有定时器时由定时器按最早的截止时间重新调度
+func (a *Assembler) schedule(delay time.Duration) {
+	if a.scheduled {
+		return
+	}
+
+	a.scheduled = true
+	if a.timer == nil {
+		a.timer = time.AfterFunc(delay, a.onTimer)
+		return
+	}
+	a.timer.Reset(delay)
+}
+
+func (a *Assembler) onTimer() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	a.expire(now)
+	a.scheduled = false
+
+	var earliest time.Time
+	for _, t := range a.transfers {
+		if earliest.IsZero() || t.deadline.Before(earliest) {
+			earliest = t.deadline
+		}
+	}
+
+	if !earliest.IsZero() {
+		// 截止时间之后才算超时
+		a.schedule(earliest.Sub(now) + time.Millisecond)
+	}
+}
+
+func (a *Assembler) expire(now time.Time) {
+	for transferId, t := range a.transfers {
+		if now.After(t.deadline) {
+			delete(a.transfers, transferId)
+		}
+	}
+}
+
+func (t *transfer) assemble(check func(data []byte) error) (pkg *base.Package, err error) {
+	data := make([]byte, 0, t.size)
+	for _, part := range t.parts {
+		data = append(data, part...)
+	}
+
+	if len(data) != t.size {
+		return nil, ErrChunkFormat
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != t.checksum {
+		return nil, ErrChunkChecksum
+	}
+
+	if check != nil {
+		if err = check(data); err != nil {
+			return nil, err
+		}
+	}
+
+	pkg = &base.Package{}
+	if err = pkg.Unpack(data); err != nil {
+		return nil, err
+	}
+
+	if pkg.Id != t.eventId {
+		return nil, ErrChunkFormat
+	}
+	return pkg, nil
+}
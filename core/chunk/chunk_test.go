@@ -0,0 +1,140 @@
+package chunk
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-boot/base"
+)
+
+func transport(pkg *base.Package) *base.Package {
+	p := &base.Package{}
+	_ = p.Unpack(pkg.Pack())
+	return p
+}
+
+func TestAssembler_Add(t *testing.T) {
+	pkg := &base.Package{
+		Id:   base.EventLogin,
+		Name: "login",
+		Param: base.JsonParam{
+			"data": strings.Repeat("abcdefgh", 1024),
+		},
+	}
+
+	var (
+		progress  int
+		assembler = NewAssembler(Option{}, func(transferId string, eventId uint16, done, size int) {
+			progress = done
+		})
+		full *base.Package
+	)
+
+	chunks := Split(pkg, MinChunkSize)
+	if len(chunks) < 8 {
+		t.Fatalf("want more than 8 chunks, got %d", len(chunks))
+	}
+
+	// 乱序到达
+	for index := len(chunks) - 1; index >= 0; index-- {
+		p, err := assembler.Add(transport(chunks[index]))
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		if p != nil {
+			full = p
+		}
+	}
+
+	if full == nil || full.Param.String("data") != pkg.Param.String("data") {
+		t.Fatalf("want assembled package, got %v", full)
+	}
+
+	if progress != chunks[0].Param["size"].(int) || assembler.Pending() != 0 {
+		t.Fatalf("want done, got %d %d", progress, assembler.Pending())
+	}
+}
+
+func TestAssembler_Reject(t *testing.T) {
+	pkg := &base.Package{
+		Id:    base.EventLogin,
+		Param: base.JsonParam{"data": strings.Repeat("a", 4096)},
+	}
+
+	assembler := NewAssembler(Option{MaxSize: 1024}, nil)
+	if _, err := assembler.Add(transport(Split(pkg, MinChunkSize)[0])); err != ErrChunkTooLarge {
+		t.Fatalf("want %s, got %v", ErrChunkTooLarge, err)
+	}
+
+	var (
+		err    error
+		chunks = Split(pkg, MinChunkSize)
+	)
+
+	assembler = NewAssembler(Option{}, nil)
+	for index, c := range chunks {
+		c = transport(c)
+		if index == 0 {
+			c.Param["sum"] = strings.Repeat("0", 64)
+		}
+
+		if _, err = assembler.Add(c); err != nil {
+			break
+		}
+	}
+
+	if err != ErrChunkChecksum {
+		t.Fatalf("want %s, got %v", ErrChunkChecksum, err)
+	}
+}
+
+func TestAssembler_Check(t *testing.T) {
+	pkg := &base.Package{
+		Id:    base.EventLogin,
+		Name:  "login",
+		Param: base.JsonParam{"data": strings.Repeat("a", MinChunkSize*2)},
+	}
+
+	errCheck := errors.New("too large")
+	assembler := NewAssembler(Option{Check: func(data []byte) error {
+		return errCheck
+	}}, nil)
+
+	var err error
+	for _, c := range Split(pkg, MinChunkSize) {
+		_, err = assembler.Add(transport(c))
+	}
+
+	if err != errCheck {
+		t.Fatalf("want %v, got %v", errCheck, err)
+	}
+}
+
+func TestAssembler_Expire(t *testing.T) {
+	pkg := &base.Package{
+		Id:    base.EventLogin,
+		Name:  "login",
+		Param: base.JsonParam{"data": strings.Repeat("a", MinChunkSize*2)},
+	}
+
+	assembler := NewAssembler(Option{Timeout: time.Millisecond * 50}, nil)
+	for _, chunks := range [][]*base.Package{Split(pkg, MinChunkSize), Split(pkg, MinChunkSize)} {
+		if _, err := assembler.Add(transport(chunks[0])); err != nil {
+			t.Fatalf("want nil, got %v", err)
+		}
+		time.Sleep(time.Millisecond * 30)
+	}
+
+	// 不调用Add和Pending，由定时器清理
+	time.Sleep(time.Millisecond * 100)
+	assembler.mutex.Lock()
+	pending := len(assembler.transfers)
+	assembler.mutex.Unlock()
+
+	if pending != 0 {
+		t.Fatalf("want 0, got %d", pending)
+	}
+}
@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/grpc-boot/base"
+)
+
+const (
+	NameJson     = `json`
+	NameMsgPack  = `msgpack`
+	NameProtobuf = `protobuf`
+)
+
+var (
+	ErrCodecNotExists = errors.New("codec not exists")
+)
+
+// Codec 将base.Package编解码为websocket消息，Binary为true时使用二进制帧传输
+type Codec interface {
+	Name() string
+	Binary() bool
+	Marshal(pkg *base.Package) ([]byte, error)
+	Unmarshal(data []byte) (pkg *base.Package, err error)
+	MarshalParam(param base.JsonParam) ([]byte, error)
+	UnmarshalParam(data []byte) (param base.JsonParam, err error)
+}
+
+var (
+	codecs sync.Map
+)
+
+func init() {
+	Register(&jsonCodec{})
+	Register(&msgPackCodec{})
+	Register(&protobufCodec{})
+}
+
+func Register(c Codec) {
+	codecs.Store(c.Name(), c)
+}
+
+func Get(name string) (c Codec, err error) {
+	if name == "" {
+		name = NameJson
+	}
+
+	value, exists := codecs.Load(name)
+	if !exists {
+		return nil, ErrCodecNotExists
+	}
+
+	return value.(Codec), nil
+}
+
+// normalize 将数值统一转换为float64，与JsonParam的取值方式保持一致
+func normalize(value interface{}) interface{} {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		for k, v := range val {
+			val[k] = normalize(v)
+		}
+		return val
+	case []interface{}:
+		for index := range val {
+			val[index] = normalize(val[index])
+		}
+		return val
+	case int8:
+		return float64(val)
+	case int16:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case int:
+		return float64(val)
+	case uint8:
+		return float64(val)
+	case uint16:
+		return float64(val)
+	case uint32:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case uint:
+		return float64(val)
+	case float32:
+		return float64(val)
+	default:
+		return value
+	}
+}
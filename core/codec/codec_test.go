@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/grpc-boot/base"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, name := range []string{NameJson, NameMsgPack, NameProtobuf} {
+		cdc, err := Get(name)
+		if err != nil {
+			t.Fatalf("want nil, got %s", err)
+		}
+
+		data, err := cdc.Marshal(&base.Package{
+			Id:   base.EventLogin,
+			Name: "login",
+			Param: base.JsonParam{
+				"token": "abc",
+				"uid":   int64(1024),
+				"tags":  []interface{}{"a", 1},
+				"extra": map[string]interface{}{"level": uint8(3)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s want nil, got %s", name, err)
+		}
+
+		pkg, err := cdc.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s want nil, got %s", name, err)
+		}
+
+		if pkg.Id != base.EventLogin || pkg.Name != "login" {
+			t.Fatalf("%s want %d login, got %d %s", name, base.EventLogin, pkg.Id, pkg.Name)
+		}
+
+		if pkg.Param.String("token") != "abc" || pkg.Param.Int64("uid") != 1024 {
+			t.Fatalf("%s want abc 1024, got %v", name, pkg.Param)
+		}
+
+		extra, _ := pkg.Param["extra"].(map[string]interface{})
+		if base.JsonParam(extra).Int("level") != 3 {
+			t.Fatalf("%s want 3, got %v", name, extra)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	if _, err := Get("xml"); err != ErrCodecNotExists {
+		t.Fatalf("want %s, got %v", ErrCodecNotExists, err)
+	}
+
+	cdc, err := Get("")
+	if err != nil || cdc.Binary() {
+		t.Fatalf("want json codec, got %v %v", cdc, err)
+	}
+}
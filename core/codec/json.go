@@ -0,0 +1,33 @@
+package codec
+
+import (
+	"github.com/grpc-boot/base"
+)
+
+type jsonCodec struct{}
+
+func (jc *jsonCodec) Name() string {
+	return NameJson
+}
+
+func (jc *jsonCodec) Binary() bool {
+	return false
+}
+
+func (jc *jsonCodec) Marshal(pkg *base.Package) ([]byte, error) {
+	return base.JsonMarshal(pkg)
+}
+
+func (jc *jsonCodec) Unmarshal(data []byte) (pkg *base.Package, err error) {
+	pkg = &base.Package{}
+	err = pkg.Unpack(data)
+	return
+}
+
+func (jc *jsonCodec) MarshalParam(param base.JsonParam) ([]byte, error) {
+	return base.JsonMarshal(param)
+}
+
+func (jc *jsonCodec) UnmarshalParam(data []byte) (param base.JsonParam, err error) {
+	return base.UnmarshalJsonParam(data)
+}
@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"github.com/grpc-boot/base"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type msgPackage struct {
+	Id    uint16                 `msgpack:"id"`
+	Name  string                 `msgpack:"name"`
+	Param map[string]interface{} `msgpack:"param"`
+}
+
+type msgPackCodec struct{}
+
+func (mc *msgPackCodec) Name() string {
+	return NameMsgPack
+}
+
+func (mc *msgPackCodec) Binary() bool {
+	return true
+}
+
+func (mc *msgPackCodec) Marshal(pkg *base.Package) ([]byte, error) {
+	return msgpack.Marshal(&msgPackage{
+		Id:    pkg.Id,
+		Name:  pkg.Name,
+		Param: pkg.Param,
+	})
+}
+
+func (mc *msgPackCodec) Unmarshal(data []byte) (pkg *base.Package, err error) {
+	if len(data) < 1 {
+		return nil, base.ErrDataEmpty
+	}
+
+	mp := &msgPackage{}
+	if err = msgpack.Unmarshal(data, mp); err != nil {
+		return nil, err
+	}
+
+	pkg = &base.Package{
+		Id:   mp.Id,
+		Name: mp.Name,
+	}
+
+	if mp.Param != nil {
+		pkg.Param = normalize(mp.Param).(map[string]interface{})
+	}
+	return
+}
+
+func (mc *msgPackCodec) MarshalParam(param base.JsonParam) ([]byte, error) {
+	return msgpack.Marshal(map[string]interface{}(param))
+}
+
+func (mc *msgPackCodec) UnmarshalParam(data []byte) (param base.JsonParam, err error) {
+	var value map[string]interface{}
+	if err = msgpack.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return nil, nil
+	}
+	return normalize(value).(map[string]interface{}), nil
+}
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"github.com/grpc-boot/base"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	fieldId    protowire.Number = 1
+	fieldName  protowire.Number = 2
+	fieldParam protowire.Number = 3
+)
+
+// protobufCodec 按package.proto编码，不依赖生成代码
+type protobufCodec struct{}
+
+func (pc *protobufCodec) Name() string {
+	return NameProtobuf
+}
+
+func (pc *protobufCodec) Binary() bool {
+	return true
+}
+
+func (pc *protobufCodec) Marshal(pkg *base.Package) ([]byte, error) {
+	data := make([]byte, 0, 64)
+	data = protowire.AppendTag(data, fieldId, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(pkg.Id))
+
+	if pkg.Name != "" {
+		data = protowire.AppendTag(data, fieldName, protowire.BytesType)
+		data = protowire.AppendString(data, pkg.Name)
+	}
+
+	if len(pkg.Param) > 0 {
+		paramData, err := pc.MarshalParam(pkg.Param)
+		if err != nil {
+			return nil, err
+		}
+
+		data = protowire.AppendTag(data, fieldParam, protowire.BytesType)
+		data = protowire.AppendBytes(data, paramData)
+	}
+
+	return data, nil
+}
+
+func (pc *protobufCodec) Unmarshal(data []byte) (pkg *base.Package, err error) {
+	if len(data) < 1 {
+		return nil, base.ErrDataEmpty
+	}
+
+	pkg = &base.Package{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, base.ErrDataFormat
+		}
+		data = data[n:]
+
+		switch {
+		case num == fieldId && typ == protowire.VarintType:
+			id, l := protowire.ConsumeVarint(data)
+			if l < 0 || id > 0xffff {
+				return nil, base.ErrDataFormat
+			}
+			pkg.Id, n = uint16(id), l
+		case num == fieldName && typ == protowire.BytesType:
+			pkg.Name, n = protowire.ConsumeString(data)
+		case num == fieldParam && typ == protowire.BytesType:
+			var paramData []byte
+			paramData, n = protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, base.ErrDataFormat
+			}
+
+			if pkg.Param, err = pc.UnmarshalParam(paramData); err != nil {
+				return nil, err
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		if n < 0 {
+			return nil, base.ErrDataFormat
+		}
+		data = data[n:]
+	}
+
+	return pkg, nil
+}
+
+func (pc *protobufCodec) MarshalParam(param base.JsonParam) ([]byte, error) {
+	st, err := toStruct(param)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(st)
+}
+
+func (pc *protobufCodec) UnmarshalParam(data []byte) (param base.JsonParam, err error) {
+	st := &structpb.Struct{}
+	if err = proto.Unmarshal(data, st); err != nil {
+		return nil, err
+	}
+
+	return st.AsMap(), nil
+}
+
+func toStruct(param base.JsonParam) (*structpb.Struct, error) {
+	st, err := structpb.NewStruct(param)
+	if err == nil {
+		return st, nil
+	}
+
+	// 含有structpb不支持的类型时，先经过json转换为通用类型
+	plain, err := base.UnmarshalJsonParam(param.JsonMarshal())
+	if err != nil {
+		return nil, err
+	}
+
+	return structpb.NewStruct(plain)
+}
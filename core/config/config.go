@@ -0,0 +1,295 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"event/core/secret"
+
+	"github.com/grpc-boot/base"
+)
+
+const (
+	DefaultFile      = "./conf/app.json"
+	DefaultEnvPrefix = "EVENT_"
+
+	// envProfile 未通过Option指定profile时读取的环境变量，不带前缀
+	envProfile = "PROFILE"
+)
+
+// topLevel base.Config中params以外的字段，logger展开为logger.xxx
+var topLevel = map[string]bool{
+	"name": true, "env": true, "ver": true, "addr": true, "pprofAddr": true,
+	"logger.level": true, "logger.path": true, "logger.tickSecond": true,
+}
+
+var (
+	ErrProfileNotFound = errors.New("config: profile file not found")
+)
+
+// Option 加载顺序: 配置文件 < profile文件 < 环境变量 < Overrides
+type Option struct {
+	File string
+	// Profile 为空时依次使用环境变量EVENT_PROFILE与配置文件中的env
+	Profile string
+	// Overrides key=value，一般来自命令行
+	Overrides []string
+	// EnvPrefix 环境变量前缀，key转换为大写下划线，如numLoops对应EVENT_NUM_LOOPS
+	EnvPrefix string
+	Schema    Schema
+}
+
+func (opt *Option) init() {
+	if opt.File == "" {
+		opt.File = DefaultFile
+	}
+
+	if opt.EnvPrefix == "" {
+		opt.EnvPrefix = DefaultEnvPrefix
+	}
+}
+
+// ValidationError 所有不合法与未知的配置项
+type ValidationError struct {
+	Errors []string
+}
+
+func (ve *ValidationError) Error() string {
+	return "config: " + strings.Join(ve.Errors, "; ")
+}
+
+// Result 加载结果，SecretKeys为来自env:、file:、enc:引用的key
+type Result struct {
+	Config     *base.Config
+	Profile    string
+	SecretKeys []string
+}
+
+// EnvName key对应的环境变量名
+func EnvName(prefix, key string) string {
+	var (
+		name = strings.Builder{}
+		prev rune
+	)
+
+	name.WriteString(prefix)
+	for _, r := range key {
+		switch {
+		case r == '.':
+			name.WriteByte('_')
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			name.WriteByte('_')
+			name.WriteRune(r)
+		default:
+			name.WriteRune(unicode.ToUpper(r))
+		}
+		prev = r
+	}
+	return name.String()
+}
+
+// ProfileFile app.json的profile文件为app.<profile>.json
+func ProfileFile(file, profile string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + profile + ext
+}
+
+func readFlat(file string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	flat, err := flatten(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return flat, nil
+}
+
+// flatten params与logger展开到同一层
+func flatten(raw map[string]interface{}) (map[string]interface{}, error) {
+	flat := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		switch key {
+		case "params", "logger":
+			section, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s must be an object", key)
+			}
+
+			for k, v := range section {
+				if key == "logger" {
+					k = "logger." + k
+				}
+				flat[k] = v
+			}
+		default:
+			flat[key] = value
+		}
+	}
+	return flat, nil
+}
+
+// Flatten 展开后的配置，key与Schema一致
+func Flatten(c *base.Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return flatten(raw)
+}
+
+// Changed 新增、删除或值不同的key，按名称排序
+func Changed(old, new map[string]interface{}) []string {
+	var keys []string
+	for key, value := range new {
+		if oldValue, exists := old[key]; !exists || !reflect.DeepEqual(oldValue, value) {
+			keys = append(keys, key)
+		}
+	}
+
+	for key := range old {
+		if _, exists := new[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func Load(opt Option) (*Result, error) {
+	opt.init()
+
+	flat, err := readFlat(opt.File)
+	if err != nil {
+		return nil, err
+	}
+
+	// 指定的profile文件必须存在，由env推断的可以不存在
+	profile, explicit := opt.Profile, true
+	if profile == "" {
+		profile = os.Getenv(opt.EnvPrefix + envProfile)
+	}
+
+	if profile == "" {
+		profile, _ = flat["env"].(string)
+		explicit = false
+	}
+
+	if profile != "" {
+		overlay, err := readFlat(ProfileFile(opt.File, profile))
+		switch {
+		case err == nil:
+			for key, value := range overlay {
+				flat[key] = value
+			}
+		case os.IsNotExist(err) && !explicit:
+		case os.IsNotExist(err):
+			return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, ProfileFile(opt.File, profile))
+		default:
+			return nil, err
+		}
+	}
+
+	var errs []string
+
+	// 环境变量
+	for key := range opt.Schema {
+		if value, exists := os.LookupEnv(EnvName(opt.EnvPrefix, key)); exists {
+			flat[key] = value
+		}
+	}
+
+	// 命令行
+	for _, override := range opt.Overrides {
+		index := strings.IndexByte(override, '=')
+		if index < 1 {
+			errs = append(errs, fmt.Sprintf("override %q: want key=value", override))
+			continue
+		}
+		flat[override[:index]] = override[index+1:]
+	}
+
+	secretKeys, err := secret.ResolveParams(flat)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	for key, value := range flat {
+		rule, exists := opt.Schema[key]
+		if !exists {
+			errs = append(errs, fmt.Sprintf("%s: unknown key", key))
+			continue
+		}
+
+		// 环境变量与命令行中的值都是字符串，check时按规则转换
+		if flat[key], err = rule.check(value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	c, err := Build(flat)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Config: c, Profile: profile, SecretKeys: secretKeys}, nil
+}
+
+// Build 由展开的配置生成base.Config
+func Build(flat map[string]interface{}) (*base.Config, error) {
+	var (
+		raw    = map[string]interface{}{}
+		logger = map[string]interface{}{}
+		params = map[string]interface{}{}
+	)
+
+	for key, value := range flat {
+		switch {
+		case strings.HasPrefix(key, "logger."):
+			logger[strings.TrimPrefix(key, "logger.")] = value
+		case topLevel[key]:
+			raw[key] = value
+		default:
+			params[key] = value
+		}
+	}
+
+	raw["logger"] = logger
+	raw["params"] = params
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &base.Config{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
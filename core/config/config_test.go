@@ -0,0 +1,104 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var schema = Schema{
+	"env":            String(),
+	"addr":           String(),
+	"logger.level":   Int(-1, 5),
+	"numLoops":       Int(1, Unlimited),
+	"accept.level":   Int(0, 3),
+	"compress.level": Int(-2, 9),
+	"rate.penalty":   String("drop", "error"),
+	"handshake.tags": Strings(),
+}
+
+func TestEnvName(t *testing.T) {
+	cases := map[string]string{
+		"addr":                  "EVENT_ADDR",
+		"numLoops":              "EVENT_NUM_LOOPS",
+		"accept.level":          "EVENT_ACCEPT_LEVEL",
+		"admission.maxMemoryMB": "EVENT_ADMISSION_MAX_MEMORY_MB",
+	}
+
+	for key, want := range cases {
+		if got := EnvName(DefaultEnvPrefix, key); got != want {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.json")
+	_ = ioutil.WriteFile(file, []byte(`{"env":"dev","addr":":3333","logger":{"level":-1},"params":{"numLoops":4,"accept.level":0,"compress.level":1}}`), 0600)
+	_ = ioutil.WriteFile(filepath.Join(dir, "app.prod.json"), []byte(`{"addr":":80","params":{"numLoops":8}}`), 0600)
+
+	t.Setenv("EVENT_ACCEPT_LEVEL", "2")
+	t.Setenv("EVENT_HANDSHAKE_TAGS", "a, b")
+
+	result, err := Load(Option{File: file, Profile: "prod", Overrides: []string{"numLoops=16"}, Schema: schema})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	c := result.Config
+	if c.Addr != ":80" || c.Params.Int("numLoops") != 16 || c.Params.Int("accept.level") != 2 || c.Logger.Level != -1 {
+		t.Fatalf("want profile, env and override applied, got %+v", c)
+	}
+
+	if tags := c.Params.StringSlice("handshake.tags"); len(tags) != 2 || tags[1] != "b" {
+		t.Fatalf("want [a b], got %v", tags)
+	}
+
+	// dev由env推断，文件不存在时忽略；指定的profile文件必须存在
+	if _, err = Load(Option{File: file, Schema: schema}); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if _, err = Load(Option{File: file, Profile: "stage", Schema: schema}); err == nil {
+		t.Fatalf("want profile not found, got nil")
+	}
+
+	_, err = Load(Option{File: file, Overrides: []string{"numLoops=0", "compress.level=x", "rate.penalty=ban", "unknown=1", "bad"}, Schema: schema})
+	ve, ok := err.(*ValidationError)
+	if !ok || len(ve.Errors) != 5 {
+		t.Fatalf("want 5 errors, got %v", err)
+	}
+
+	if !strings.Contains(ve.Error(), "unknown: unknown key") {
+		t.Fatalf("want unknown key reported, got %s", ve)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.json")
+	_ = ioutil.WriteFile(file, []byte(`{"env":"dev","addr":":3333","logger":{"level":-1},"params":{"numLoops":4,"handshake.tags":["a"]}}`), 0600)
+
+	old, err := Load(Option{File: file, Schema: schema})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	result, err := Load(Option{File: file, Overrides: []string{"logger.level=1", "handshake.tags=a,b", "accept.level=1"}, Schema: schema})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	oldFlat, _ := Flatten(old.Config)
+	newFlat, _ := Flatten(result.Config)
+	changed := Changed(oldFlat, newFlat)
+	if strings.Join(changed, ",") != "accept.level,handshake.tags,logger.level" {
+		t.Fatalf("want accept.level,handshake.tags,logger.level, got %v", changed)
+	}
+
+	if changed = Changed(oldFlat, oldFlat); len(changed) != 0 {
+		t.Fatalf("want no change, got %v", changed)
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Kind uint8
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindFloat
+	KindBool
+	KindStrings
+	// KindAny 数组或对象，由使用方自行解析
+	KindAny
+)
+
+var kindNames = [...]string{"string", "int", "float", "bool", "string array", "json"}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+const (
+	Unlimited = math.MaxFloat64
+)
+
+// Rule 单个配置项的类型与取值范围
+type Rule struct {
+	Kind     Kind
+	Min, Max float64
+	Enum     []string
+}
+
+func String(enum ...string) Rule {
+	return Rule{Kind: KindString, Enum: enum}
+}
+
+func Int(min, max float64) Rule {
+	return Rule{Kind: KindInt, Min: min, Max: max}
+}
+
+func Float(min, max float64) Rule {
+	return Rule{Kind: KindFloat, Min: min, Max: max}
+}
+
+func Bool() Rule {
+	return Rule{Kind: KindBool}
+}
+
+func Strings() Rule {
+	return Rule{Kind: KindStrings}
+}
+
+func Any() Rule {
+	return Rule{Kind: KindAny}
+}
+
+// Schema 配置项名称到规则，顶层字段与params中的key在同一个命名空间
+type Schema map[string]Rule
+
+// parse 把环境变量与命令行中的字符串转换为对应类型
+func (r Rule) parse(text string) (interface{}, error) {
+	switch r.Kind {
+	case KindInt, KindFloat:
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case KindBool:
+		return strconv.ParseBool(strings.TrimSpace(text))
+	case KindStrings:
+		if strings.HasPrefix(strings.TrimSpace(text), "[") {
+			var value []interface{}
+			err := json.Unmarshal([]byte(text), &value)
+			return value, err
+		}
+
+		value := []interface{}{}
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				value = append(value, item)
+			}
+		}
+		return value, nil
+	case KindAny:
+		var value interface{}
+		err := json.Unmarshal([]byte(text), &value)
+		return value, err
+	default:
+		return text, nil
+	}
+}
+
+// check 校验并返回规范化后的值，字符串形式的数字与布尔值会被转换
+func (r Rule) check(value interface{}) (interface{}, error) {
+	if text, ok := value.(string); ok && r.Kind != KindString {
+		parsed, err := r.parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("want %s, got %q", r.Kind, text)
+		}
+		value = parsed
+	}
+
+	switch r.Kind {
+	case KindString:
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("want string, got %v", value)
+		}
+
+		if len(r.Enum) > 0 && !contains(r.Enum, text) {
+			return nil, fmt.Errorf("want one of %s, got %q", strings.Join(r.Enum, "|"), text)
+		}
+	case KindInt, KindFloat:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("want %s, got %v", r.Kind, value)
+		}
+
+		if r.Kind == KindInt && number != math.Trunc(number) {
+			return nil, fmt.Errorf("want int, got %v", number)
+		}
+
+		if number < r.Min || number > r.Max {
+			return nil, fmt.Errorf("want %s in [%v, %v], got %v", r.Kind, r.Min, limit(r.Max), number)
+		}
+	case KindBool:
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("want bool, got %v", value)
+		}
+	case KindStrings:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("want string array, got %v", value)
+		}
+
+		for _, item := range items {
+			if _, ok = item.(string); !ok {
+				return nil, fmt.Errorf("want string array, got item %v", item)
+			}
+		}
+	}
+	return value, nil
+}
+
+func limit(max float64) interface{} {
+	if max == Unlimited {
+		return "+inf"
+	}
+	return max
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,388 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+
+	// ContentType prometheus文本格式0.0.4
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// DefaultBuckets 与prometheus客户端的默认值相同，单位秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry 指标集合，按注册顺序输出
+type Registry struct {
+	mutex   sync.RWMutex
+	names   map[string]bool
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write 以prometheus文本格式输出全部指标
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.RLock()
+	metrics := r.metrics
+	r.mutex.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.Write(w)
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// series 带标签的时间序列，key为标签值以\xff连接
+type series struct {
+	mutex  sync.RWMutex
+	values map[string]interface{}
+}
+
+func (s *series) get(labels []string, values []string, create func() interface{}) interface{} {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metrics: want %d label values, got %d", len(labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	s.mutex.RLock()
+	value, exists := s.values[key]
+	s.mutex.RUnlock()
+	if exists {
+		return value
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if value, exists = s.values[key]; !exists {
+		value = create()
+		s.values[key] = value
+	}
+	return value
+}
+
+// sorted 输出时按标签值排序，保证结果稳定
+func (s *series) sorted() (keys []string, values []interface{}) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys = make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values = make([]interface{}, len(keys))
+	for index, key := range keys {
+		values[index] = s.values[key]
+	}
+	return
+}
+
+// Counter 只增不减的计数
+type Counter struct {
+	value atomic.Float64
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.value.Add(delta)
+}
+
+func (c *Counter) Value() float64 {
+	return c.value.Load()
+}
+
+type CounterVec struct {
+	desc
+	series
+}
+
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{
+		desc:   desc{name: name, help: help, kind: typeCounter, labels: labels},
+		series: series{values: make(map[string]interface{})},
+	}
+	r.register(name, cv)
+	return cv
+}
+
+// With 按标签值取得计数，值的数量需要与标签一致
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.get(cv.labels, values, func() interface{} {
+		return &Counter{}
+	}).(*Counter)
+}
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	cv.header(w)
+	keys, values := cv.sorted()
+	for index, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", cv.name, labelPairs(cv.labels, key, "", ""), formatFloat(values[index].(*Counter).Value()))
+	}
+}
+
+// Gauge 可增可减的当前值
+type Gauge struct {
+	value atomic.Float64
+}
+
+func (g *Gauge) Set(value float64) {
+	g.value.Store(value)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.value.Add(delta)
+}
+
+func (g *Gauge) Value() float64 {
+	return g.value.Load()
+}
+
+type GaugeVec struct {
+	desc
+	series
+}
+
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help).With()
+}
+
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	gv := &GaugeVec{
+		desc:   desc{name: name, help: help, kind: typeGauge, labels: labels},
+		series: series{values: make(map[string]interface{})},
+	}
+	r.register(name, gv)
+	return gv
+}
+
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.get(gv.labels, values, func() interface{} {
+		return &Gauge{}
+	}).(*Gauge)
+}
+
+func (gv *GaugeVec) write(w *bufio.Writer) {
+	gv.header(w)
+	keys, values := gv.sorted()
+	for index, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", gv.name, labelPairs(gv.labels, key, "", ""), formatFloat(values[index].(*Gauge).Value()))
+	}
+}
+
+// gaugeFunc 输出时调用fn取值，用于连接数、队列长度等已有的状态
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &gaugeFunc{desc: desc{name: name, help: help, kind: typeGauge}, fn: fn})
+}
+
+func (gf *gaugeFunc) write(w *bufio.Writer) {
+	gf.header(w)
+	fmt.Fprintf(w, "%s %s\n", gf.name, formatFloat(gf.fn()))
+}
+
+// Histogram 累计分布，buckets为各桶上限，递增
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(value float64) {
+	index := sort.SearchFloat64s(h.buckets, value)
+	if index < len(h.buckets) {
+		h.counts[index].Inc()
+	}
+	h.count.Inc()
+	h.sum.Add(value)
+}
+
+type HistogramVec struct {
+	desc
+	series
+	buckets []float64
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.HistogramVec(name, help, buckets).With()
+}
+
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+
+	hv := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: typeHistogram, labels: labels},
+		series:  series{values: make(map[string]interface{})},
+		buckets: buckets,
+	}
+	r.register(name, hv)
+	return hv
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.get(hv.labels, values, func() interface{} {
+		return newHistogram(hv.buckets)
+	}).(*Histogram)
+}
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	hv.header(w)
+	keys, values := hv.sorted()
+	for index, key := range keys {
+		h := values[index].(*Histogram)
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += h.counts[i].Load()
+			fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, labelPairs(hv.labels, key, "le", formatFloat(upper)), cumulative)
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, labelPairs(hv.labels, key, "le", "+Inf"), h.count.Load())
+		fmt.Fprintf(w, "%s_sum%s %s\n", hv.name, labelPairs(hv.labels, key, "", ""), formatFloat(h.sum.Load()))
+		fmt.Fprintf(w, "%s_count%s %d\n", hv.name, labelPairs(hv.labels, key, "", ""), h.count.Load())
+	}
+}
+
+// labelPairs extraName不为空时追加在最后，用于histogram的le
+func labelPairs(labels []string, key, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+
+	var (
+		b      strings.Builder
+		values []string
+	)
+
+	if len(labels) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+
+	b.WriteByte('{')
+	for index, label := range labels {
+		if index > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[index]))
+		b.WriteByte('"')
+	}
+
+	if extraName != "" {
+		if len(labels) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
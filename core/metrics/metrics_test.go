@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+
+	counter := r.CounterVec("event_test_total", "Test counter.", "event")
+	counter.With("0x0300").Inc()
+	counter.With("0x0300").Add(2)
+	counter.With(`a"b`).Inc()
+
+	r.GaugeFunc("event_test_depth", "Test gauge.", func() float64 {
+		return 7
+	})
+
+	histogram := r.Histogram("event_test_seconds", "Test histogram.", []float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	want := `# HELP event_test_total Test counter.
+# TYPE event_test_total counter
+event_test_total{event="0x0300"} 3
+event_test_total{event="a\"b"} 1
+# HELP event_test_depth Test gauge.
+# TYPE event_test_depth gauge
+event_test_depth 7
+# HELP event_test_seconds Test histogram.
+# TYPE event_test_seconds histogram
+event_test_seconds_bucket{le="0.1"} 1
+event_test_seconds_bucket{le="1"} 2
+event_test_seconds_bucket{le="+Inf"} 3
+event_test_seconds_sum 5.55
+event_test_seconds_count 3
+`
+	if out.String() != want {
+		t.Fatalf("want %s, got %s", want, out.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("want panic, got nil")
+		}
+	}()
+	r.Counter("event_test_total", "Duplicate.")
+}
@@ -0,0 +1,120 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+
+	"event/core/codec"
+
+	"github.com/grpc-boot/base"
+	"go.uber.org/atomic"
+)
+
+// Accept 在base.Accept的基础上支持二进制编码、紧凑协议与密钥环
+type Accept struct {
+	ring    *KeyRing
+	signKey ed25519.PrivateKey
+	level   atomic.Uint32
+	v0      base.Protocol
+}
+
+// NewAccept level为允许的最低加密强度，取值见StrengthJson~StrengthAead
+func NewAccept(aes *base.Aes, level uint8) *Accept {
+	return NewAcceptWithKeyRing(NewSingleKeyRing(aes), level)
+}
+
+func NewAcceptWithKeyRing(ring *KeyRing, level uint8) *Accept {
+	v0, _ := base.NewV0()
+
+	a := &Accept{
+		ring: ring,
+		v0:   v0,
+	}
+	a.level.Store(uint32(level))
+	return a
+}
+
+// SetLevel 更新允许的最低加密强度，只影响之后的握手
+func (a *Accept) SetLevel(level uint8) {
+	a.level.Store(uint32(level))
+}
+
+func (a *Accept) Level() uint8 {
+	return uint8(a.level.Load())
+}
+
+// WithSignKey 设置后才接受LevelEcdh
+func (a *Accept) WithSignKey(signKey ed25519.PrivateKey) *Accept {
+	a.signKey = signKey
+	return a
+}
+
+func (a *Accept) KeyRing() *KeyRing {
+	return a.ring
+}
+
+// Accept 使用primary密钥
+func (a *Accept) Accept(level uint8, secretData []byte, cdc codec.Codec) (protocol base.Protocol, err error) {
+	return a.AcceptKey(level, "", secretData, cdc)
+}
+
+// AcceptKey 使用keyId对应的密钥解密secretData，V2握手还需要用该密钥加密响应
+func (a *Accept) AcceptKey(level uint8, keyId string, secretData []byte, cdc codec.Codec) (protocol base.Protocol, err error) {
+	if level > LevelEcdh || Strength(level) < a.Level() {
+		return nil, base.ErrForbidden
+	}
+
+	if cdc.Binary() && (level <= base.LevelV2 || level >= LevelAead) {
+		// 二进制编码的完整包不加密，加密请使用紧凑协议
+		if level > base.LevelJson {
+			return nil, base.ErrForbidden
+		}
+		return NewPlain(cdc), nil
+	}
+
+	if level == LevelCompact {
+		return NewCompact(cdc), nil
+	}
+
+	if level == base.LevelJson {
+		return a.v0, nil
+	}
+
+	// 密钥交换不使用预共享的aes
+	if level == LevelEcdh {
+		if a.signKey == nil {
+			return nil, base.ErrForbidden
+		}
+		return NewEcdh(a.signKey, secretData)
+	}
+
+	aes, err := a.ring.Get(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	switch level {
+	case base.LevelV1:
+		return base.NewV1(aes, secretData)
+	case base.LevelV2:
+		return base.NewV2(aes, secretData)
+	case LevelCompactV1:
+		return NewCompactV1(aes, secretData, cdc)
+	case LevelAead:
+		return NewAead(aes, secretData)
+	default:
+		return NewCompactV2(aes, secretData, cdc)
+	}
+}
+
+func (a *Accept) AcceptHex(level uint8, keyId string, hexData []byte, cdc codec.Codec) (protocol base.Protocol, err error) {
+	var data []byte
+	if len(hexData) > 0 {
+		data, err = hex.DecodeString(base.Bytes2String(hexData))
+		if err != nil {
+			return nil, base.ErrForbidden
+		}
+	}
+
+	return a.AcceptKey(level, keyId, data, cdc)
+}
@@ -0,0 +1,222 @@
+package protocol
+
+import (
+	cryptoaes "crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/grpc-boot/base"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// LevelAead AES-256-GCM，每个连接用握手交换的随机数派生收发两个密钥
+	LevelAead = 6
+
+	// AeadSecretLength 客户端随机密钥与服务端salt均为16字节随机数的hex，js可以直接按utf8处理
+	AeadSecretLength = 32
+
+	// aeadHeaderLength 包头: 4字节startTag + 4字节事件id + 16字节序号 + 8字节长度，均为hex
+	aeadHeaderLength = 32
+	aeadStartTag     = "063a"
+	aeadInfoClient   = "event aead client"
+	aeadInfoServer   = "event aead server"
+)
+
+var (
+	ErrReplay = errors.New("protocol: replayed or reordered package")
+)
+
+// Sequenced 带发送序号的协议，Pack与发送需在SendMutex内完成，保证发送顺序与序号一致
+type Sequenced interface {
+	SendMutex() *sync.Mutex
+}
+
+// aead 序号即nonce，只能递增，收到不大于上一个序号的包时拒绝
+type aead struct {
+	sendMutex   sync.Mutex
+	sealer      cipher.AEAD
+	opener      cipher.AEAD
+	sendSeq     uint64
+	recvSeq     uint64
+	responseKey []byte
+}
+
+func randSecret() ([]byte, error) {
+	data := make([]byte, AeadSecretLength/2)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, AeadSecretLength)
+	hex.Encode(secret, data)
+	return secret, nil
+}
+
+// NewAeadSecret 客户端随机密钥，使用密钥环中的aes加密后作为握手参数k
+func NewAeadSecret() ([]byte, error) {
+	return randSecret()
+}
+
+func deriveKey(secret, salt []byte, info string) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+
+	block, err := cryptoaes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newAead(secret, salt []byte, sealInfo, openInfo string) (*aead, error) {
+	sealer, err := deriveKey(secret, salt, sealInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	opener, err := deriveKey(secret, salt, openInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &aead{sealer: sealer, opener: opener}, nil
+}
+
+// NewAead 服务端解密客户端密钥，生成salt并用aes加密后通过connect success下发
+func NewAead(aes *base.Aes, secretData []byte) (protocol base.Protocol, err error) {
+	secret, err := aes.CbcDecrypt(secretData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secret) != AeadSecretLength {
+		return nil, base.ErrKeyFormat
+	}
+
+	salt, err := randSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	pt, err := newAead(secret, salt, aeadInfoServer, aeadInfoClient)
+	if err != nil {
+		return nil, err
+	}
+
+	pt.responseKey = aes.CbcEncrypt(salt)
+	return pt, nil
+}
+
+// NewAeadForClient secretData为connect success中下发的加密salt
+func NewAeadForClient(aes *base.Aes, secret, secretData []byte) (protocol base.Protocol, err error) {
+	salt, err := aes.CbcDecrypt(secretData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(salt) != AeadSecretLength {
+		return nil, base.ErrKeyFormat
+	}
+
+	return newAead(secret, salt, aeadInfoClient, aeadInfoServer)
+}
+
+func (pt *aead) ResponseKey() []byte {
+	return pt.responseKey
+}
+
+func (pt *aead) SendMutex() *sync.Mutex {
+	return &pt.sendMutex
+}
+
+func nonce(seq uint64) []byte {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint64(data[4:], seq)
+	return data
+}
+
+func (pt *aead) Pack(pkg *base.Package) []byte {
+	// 序号用尽时不能再复用nonce
+	seq := atomic.AddUint64(&pt.sendSeq, 1)
+	if seq == 0 {
+		atomic.StoreUint64(&pt.sendSeq, math.MaxUint64)
+		return nil
+	}
+
+	n := nonce(seq)
+	header := make([]byte, 0, aeadHeaderLength)
+	header = append(header, aeadStartTag...)
+	header = append(header, base.Int64ToHexWithPad(int64(pkg.Id), 4)...)
+	header = append(header, hex.EncodeToString(n[4:])...)
+
+	body := pt.sealer.Seal(nil, n, pkg.Pack(), header)
+	dst := make([]byte, base64.StdEncoding.EncodedLen(len(body)))
+	base64.StdEncoding.Encode(dst, body)
+
+	header = append(header, base.Int64ToHexWithPad(int64(len(dst)), 8)...)
+	return append(header, dst...)
+}
+
+func (pt *aead) Unpack(data []byte) (pkg *base.Package, err error) {
+	if len(data) < 1 {
+		return nil, base.ErrDataEmpty
+	}
+
+	if len(data) < aeadHeaderLength+1 || base.Bytes2String(data[:4]) != aeadStartTag {
+		return nil, base.ErrDataFormat
+	}
+
+	idInt64 := base.Hex2Int64(base.Bytes2String(data[4:8]))
+	if idInt64 < 1 || idInt64 > math.MaxUint16 {
+		return nil, base.ErrDataFormat
+	}
+
+	seqData, err := hex.DecodeString(base.Bytes2String(data[8:24]))
+	if err != nil {
+		return nil, base.ErrDataFormat
+	}
+
+	seq := binary.BigEndian.Uint64(seqData)
+	if seq <= pt.recvSeq {
+		return nil, ErrReplay
+	}
+
+	bodyLength := int(base.Hex2Int64(base.Bytes2String(data[24:aeadHeaderLength])))
+	if bodyLength+aeadHeaderLength != len(data) {
+		return nil, base.ErrDataFormat
+	}
+
+	body, err := base64.StdEncoding.DecodeString(base.Bytes2String(data[aeadHeaderLength:]))
+	if err != nil {
+		return nil, base.ErrDataFormat
+	}
+
+	jsonData, err := pt.opener.Open(nil, nonce(seq), body, data[:aeadHeaderLength-8])
+	if err != nil {
+		return nil, err
+	}
+
+	pkg = &base.Package{}
+	if err = pkg.Unpack(jsonData); err != nil {
+		return nil, err
+	}
+
+	if pkg.Id != uint16(idInt64) {
+		return nil, base.ErrDataFormat
+	}
+
+	// 认证通过后才推进序号，伪造的包不能让后续合法包失效
+	pt.recvSeq = seq
+	return pkg, nil
+}
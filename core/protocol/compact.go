@@ -0,0 +1,166 @@
+package protocol
+
+import (
+	"encoding/binary"
+
+	"event/core/codec"
+
+	"github.com/grpc-boot/base"
+)
+
+const (
+	FlagEncrypted = 1 << 0
+)
+
+const (
+	// CompactHeaderLength 包头: 2字节事件id + 1字节flags + 4字节payload长度
+	CompactHeaderLength = 7
+)
+
+// compact 紧凑协议，包头之后只传输编码后的param，不传输name
+type compact struct {
+	codec       codec.Codec
+	aes         *base.Aes
+	responseKey []byte
+}
+
+func NewCompact(cdc codec.Codec) base.Protocol {
+	return &compact{codec: cdc}
+}
+
+func NewCompactV1(aes *base.Aes, secretData []byte, cdc codec.Codec) (protocol base.Protocol, err error) {
+	data, err := aes.CbcDecrypt(secretData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 32 {
+		return nil, base.ErrKeyFormat
+	}
+
+	transAes, err := base.NewAesWithBytes(data[:16], data[16:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &compact{codec: cdc, aes: transAes}, nil
+}
+
+func NewCompactV2(aes *base.Aes, secretData []byte, cdc codec.Codec) (protocol base.Protocol, err error) {
+	data, err := aes.CbcDecrypt(secretData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 16 {
+		return nil, base.ErrKeyFormat
+	}
+
+	iv := base.RandBytes(16)
+
+	transAes, err := base.NewAesWithBytes(data, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compact{
+		codec:       cdc,
+		aes:         transAes,
+		responseKey: aes.CbcEncrypt(iv),
+	}, nil
+}
+
+func NewCompactV2ForClient(aes *base.Aes, key, secretData []byte, cdc codec.Codec) (protocol base.Protocol, err error) {
+	data, err := aes.CbcDecrypt(secretData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 16 {
+		return nil, base.ErrKeyFormat
+	}
+
+	transAes, err := base.NewAesWithBytes(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compact{codec: cdc, aes: transAes}, nil
+}
+
+func (cp *compact) Binary() bool {
+	return true
+}
+
+func (cp *compact) ResponseKey() []byte {
+	return cp.responseKey
+}
+
+func (cp *compact) flags() (flags byte) {
+	if cp.aes != nil {
+		flags |= FlagEncrypted
+	}
+	return
+}
+
+func (cp *compact) Pack(pkg *base.Package) []byte {
+	var payload []byte
+	if len(pkg.Param) > 0 {
+		var err error
+		payload, err = cp.codec.MarshalParam(pkg.Param)
+		if err != nil {
+			return nil
+		}
+
+		if cp.aes != nil {
+			payload = cp.aes.CbcEncrypt(payload)
+		}
+	}
+
+	data := make([]byte, CompactHeaderLength, CompactHeaderLength+len(payload))
+	binary.BigEndian.PutUint16(data, pkg.Id)
+	data[2] = cp.flags()
+	binary.BigEndian.PutUint32(data[3:], uint32(len(payload)))
+	return append(data, payload...)
+}
+
+func (cp *compact) Unpack(data []byte) (pkg *base.Package, err error) {
+	if len(data) < 1 {
+		return nil, base.ErrDataEmpty
+	}
+
+	if len(data) < CompactHeaderLength {
+		return nil, base.ErrDataFormat
+	}
+
+	id := binary.BigEndian.Uint16(data)
+	if id < 1 {
+		return nil, base.ErrDataFormat
+	}
+
+	if data[2]&FlagEncrypted != cp.flags()&FlagEncrypted {
+		return nil, ErrEncryptFlag
+	}
+
+	bodyLength := int(binary.BigEndian.Uint32(data[3:CompactHeaderLength]))
+	if bodyLength+CompactHeaderLength != len(data) {
+		return nil, base.ErrDataFormat
+	}
+
+	pkg = &base.Package{Id: id}
+	if bodyLength == 0 {
+		return pkg, nil
+	}
+
+	payload := data[CompactHeaderLength:]
+	if cp.aes != nil {
+		if payload, err = cp.aes.CbcDecrypt(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if pkg.Param, err = cp.codec.UnmarshalParam(payload); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/grpc-boot/base"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// LevelEcdh X25519交换会话密钥，服务端用长期Ed25519私钥签名临时公钥，之后与LevelAead相同
+	LevelEcdh = 7
+
+	ecdhSignLabel = "event ecdh"
+)
+
+var (
+	ErrSignKeyFormat = errors.New("protocol: sign key is not ed25519")
+	ErrSignature     = errors.New("protocol: invalid server signature")
+)
+
+// EcdhKey 客户端临时密钥对
+type EcdhKey struct {
+	Private []byte
+	Public  []byte
+}
+
+// NewEcdhKey 每次握手生成新的密钥对，Public的hex作为握手参数k
+func NewEcdhKey() (*EcdhKey, error) {
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, private); err != nil {
+		return nil, err
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &EcdhKey{Private: private, Public: public}, nil
+}
+
+// LoadSignKey 读取PKCS8格式的Ed25519私钥，文件不存在时返回错误，私钥由GenerateSignKey生成
+func LoadSignKey(file string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrSignKeyFormat
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrSignKeyFormat
+	}
+	return signKey, nil
+}
+
+// GenerateSignKey 生成私钥并保存为PKCS8格式，文件已存在时返回错误，不会覆盖
+func GenerateSignKey(file string) (ed25519.PrivateKey, error) {
+	_, signKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return signKey, f.Close()
+}
+
+// transcript 签名内容为标签、客户端公钥和服务端公钥，防止临时公钥被替换
+func transcript(clientPublic, serverPublic []byte) []byte {
+	data := make([]byte, 0, len(ecdhSignLabel)+len(clientPublic)+len(serverPublic))
+	data = append(data, ecdhSignLabel...)
+	data = append(data, clientPublic...)
+	return append(data, serverPublic...)
+}
+
+// NewEcdh 服务端生成临时密钥对，响应为服务端公钥与签名
+func NewEcdh(signKey ed25519.PrivateKey, clientPublic []byte) (protocol base.Protocol, err error) {
+	if len(clientPublic) != curve25519.PointSize {
+		return nil, base.ErrKeyFormat
+	}
+
+	key, err := NewEcdhKey()
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := curve25519.X25519(key.Private, clientPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, clientPublic...), key.Public...)
+	pt, err := newAead(shared, salt, aeadInfoServer, aeadInfoClient)
+	if err != nil {
+		return nil, err
+	}
+
+	pt.responseKey = append(key.Public, ed25519.Sign(signKey, transcript(clientPublic, key.Public))...)
+	return pt, nil
+}
+
+// NewEcdhForClient 用服务端签名公钥校验响应后派生会话密钥
+func NewEcdhForClient(serverKey ed25519.PublicKey, key *EcdhKey, response []byte) (protocol base.Protocol, err error) {
+	if len(serverKey) != ed25519.PublicKeySize || len(response) != curve25519.PointSize+ed25519.SignatureSize {
+		return nil, base.ErrKeyFormat
+	}
+
+	serverPublic := response[:curve25519.PointSize]
+	if !ed25519.Verify(serverKey, transcript(key.Public, serverPublic), response[curve25519.PointSize:]) {
+		return nil, ErrSignature
+	}
+
+	shared, err := curve25519.X25519(key.Private, serverPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, key.Public...), serverPublic...)
+	return newAead(shared, salt, aeadInfoClient, aeadInfoServer)
+}
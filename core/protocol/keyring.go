@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/grpc-boot/base"
+)
+
+var (
+	ErrKeyLength    = errors.New("protocol: aes key length is not 32")
+	ErrKeyDuplicate = errors.New("protocol: duplicate aes key id")
+	ErrKeyNotFound  = errors.New("protocol: aes key not found")
+	ErrPrimaryKey   = errors.New("protocol: primary key must exist and not be decrypt only")
+)
+
+// AesKey 密钥环中的密钥，Key前16字节为key，后16字节为iv
+type AesKey struct {
+	Id  string `json:"id"`
+	Key string `json:"key"`
+	// DecryptOnly 只表示不能作为primary：未携带key id的新客户端不会用到它，
+	// 轮换期间仍接受旧客户端指定该key id的握手，该连接的握手响应也用它加密
+	DecryptOnly bool `json:"decryptOnly"`
+}
+
+type ringKey struct {
+	aes         *base.Aes
+	decryptOnly bool
+}
+
+// KeyRing 按key id查找aes，握手未携带key id时使用primary，Load可在运行时整体替换
+type KeyRing struct {
+	mutex   sync.RWMutex
+	primary string
+	keys    map[string]*ringKey
+}
+
+// NewKeyRing primary为空时使用第一个非DecryptOnly的密钥
+func NewKeyRing(primary string, keys ...AesKey) (*KeyRing, error) {
+	kr := &KeyRing{}
+	if err := kr.Load(primary, keys...); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// NewSingleKeyRing 只有一个密钥的密钥环，key id为空
+func NewSingleKeyRing(aes *base.Aes) *KeyRing {
+	return &KeyRing{
+		keys: map[string]*ringKey{"": {aes: aes}},
+	}
+}
+
+// Load 校验全部密钥后再替换，失败时保留原密钥
+func (kr *KeyRing) Load(primary string, keys ...AesKey) error {
+	ring := make(map[string]*ringKey, len(keys))
+	for _, key := range keys {
+		if len(key.Key) != 32 {
+			return ErrKeyLength
+		}
+
+		if _, exists := ring[key.Id]; exists {
+			return ErrKeyDuplicate
+		}
+
+		aes, err := base.NewAes(key.Key[0:16], key.Key[16:])
+		if err != nil {
+			return err
+		}
+		ring[key.Id] = &ringKey{aes: aes, decryptOnly: key.DecryptOnly}
+
+		if primary == "" && !key.DecryptOnly {
+			primary = key.Id
+		}
+	}
+
+	if key, exists := ring[primary]; !exists || key.decryptOnly {
+		return ErrPrimaryKey
+	}
+
+	kr.mutex.Lock()
+	kr.primary = primary
+	kr.keys = ring
+	kr.mutex.Unlock()
+	return nil
+}
+
+func (kr *KeyRing) Primary() string {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	return kr.primary
+}
+
+// Ids 当前全部key id
+func (kr *KeyRing) Ids() []string {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Get id为空时返回primary，DecryptOnly的密钥同样返回
+func (kr *KeyRing) Get(id string) (*base.Aes, error) {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	if id == "" {
+		id = kr.primary
+	}
+
+	key, exists := kr.keys[id]
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+
+	return key.aes, nil
+}
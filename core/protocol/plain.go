@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"event/core/codec"
+
+	"github.com/grpc-boot/base"
+)
+
+// plain 使用二进制编码传输完整的Package，不加密
+type plain struct {
+	codec codec.Codec
+}
+
+func NewPlain(cdc codec.Codec) base.Protocol {
+	return &plain{codec: cdc}
+}
+
+func (p *plain) Binary() bool {
+	return true
+}
+
+func (p *plain) Pack(pkg *base.Package) []byte {
+	data, err := p.codec.Marshal(pkg)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (p *plain) ResponseKey() []byte {
+	return nil
+}
+
+func (p *plain) Unpack(data []byte) (pkg *base.Package, err error) {
+	return p.codec.Unmarshal(data)
+}
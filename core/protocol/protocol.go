@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"errors"
+
+	"github.com/grpc-boot/base"
+)
+
+const (
+	LevelCompact   = 3
+	LevelCompactV1 = 4
+	LevelCompactV2 = 5
+)
+
+// 加密强度，与协议的level是两套取值，accept.level按强度配置
+const (
+	StrengthJson = base.LevelJson
+	StrengthV1   = base.LevelV1
+	StrengthV2   = base.LevelV2
+	// StrengthAead LevelAead与LevelEcdh，accept.level为StrengthAead时只接受这两种
+	StrengthAead = StrengthV2 + 1
+)
+
+var (
+	ErrEncryptFlag = errors.New("protocol: encrypt flag mismatch")
+	// ErrPack 编码失败时Pack返回nil，由调用方记录
+	ErrPack = errors.New("protocol: pack failed")
+)
+
+// Binary 通过websocket二进制帧传输的协议
+type Binary interface {
+	Binary() bool
+}
+
+func IsBinary(proto base.Protocol) bool {
+	bp, ok := proto.(Binary)
+	return ok && bp.Binary()
+}
+
+// Strength 协议的加密强度，用于与accept.level比较
+func Strength(level uint8) uint8 {
+	switch level {
+	case LevelCompact:
+		return StrengthJson
+	case LevelCompactV1:
+		return StrengthV1
+	case LevelCompactV2:
+		return StrengthV2
+	case LevelAead, LevelEcdh:
+		return StrengthAead
+	default:
+		return level
+	}
+}
+
+// Encrypted 协议是否加密传输
+func Encrypted(level uint8) bool {
+	return Strength(level) > StrengthJson
+}
+
+// HasResponse 握手后是否需要下发connect success包交换密钥
+func HasResponse(level uint8) bool {
+	return Strength(level) >= StrengthV2
+}
@@ -0,0 +1,244 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"event/core/codec"
+
+	"github.com/grpc-boot/base"
+)
+
+var (
+	aes, _ = base.NewAes("SD3c523asz7*&^df", "312c45cDvd4bFc12")
+)
+
+func TestCompactV2(t *testing.T) {
+	cdc, _ := codec.Get(codec.NameMsgPack)
+	accept := NewAccept(aes, base.LevelV2)
+
+	if _, err := accept.Accept(LevelCompact, nil, cdc); err != base.ErrForbidden {
+		t.Fatalf("want %s, got %v", base.ErrForbidden, err)
+	}
+
+	key := base.RandBytes(16)
+	server, err := accept.Accept(LevelCompactV2, aes.CbcEncrypt(key), cdc)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	client, err := NewCompactV2ForClient(aes, key, server.ResponseKey(), cdc)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	data := client.Pack(&base.Package{
+		Id:   base.EventLogin,
+		Name: "login",
+		Param: base.JsonParam{
+			"token": "abc",
+		},
+	})
+
+	if data[2]&FlagEncrypted == 0 {
+		t.Fatalf("want encrypted flag, got %d", data[2])
+	}
+
+	pkg, err := server.Unpack(data)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if pkg.Id != base.EventLogin || pkg.Param.String("token") != "abc" {
+		t.Fatalf("want login abc, got %+v", pkg)
+	}
+
+	if _, err = NewCompact(cdc).Unpack(data); err != ErrEncryptFlag {
+		t.Fatalf("want %s, got %v", ErrEncryptFlag, err)
+	}
+}
+
+func TestCompact_Empty(t *testing.T) {
+	cdc, _ := codec.Get(codec.NameProtobuf)
+	proto := NewCompact(cdc)
+
+	data := proto.Pack(&base.Package{Id: base.EventTick})
+	if len(data) != CompactHeaderLength {
+		t.Fatalf("want %d, got %d", CompactHeaderLength, len(data))
+	}
+
+	pkg, err := proto.Unpack(data)
+	if err != nil || pkg.Id != base.EventTick {
+		t.Fatalf("want tick, got %+v %v", pkg, err)
+	}
+
+	if _, err = proto.Unpack(data[:CompactHeaderLength-1]); err != base.ErrDataFormat {
+		t.Fatalf("want %s, got %v", base.ErrDataFormat, err)
+	}
+
+	if _, err = proto.Unpack(append(data, 0)); err != base.ErrDataFormat {
+		t.Fatalf("want %s, got %v", base.ErrDataFormat, err)
+	}
+}
+
+func TestKeyRing_Accept(t *testing.T) {
+	cdc, _ := codec.Get(codec.NameJson)
+	ring, err := NewKeyRing("", AesKey{Id: "k0", Key: "0123456789abcdef0123456789abcdef", DecryptOnly: true}, AesKey{Id: "k1", Key: "SD3c523asz7*&^df312c45cDvd4bFc12"})
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if ring.Primary() != "k1" {
+		t.Fatalf("want k1, got %s", ring.Primary())
+	}
+
+	accept := NewAcceptWithKeyRing(ring, base.LevelJson)
+	old, _ := base.NewAes("0123456789abcdef", "0123456789abcdef")
+
+	if _, err = accept.AcceptKey(base.LevelV1, "k0", old.CbcEncrypt(base.RandBytes(32)), cdc); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	// 握手响应用客户端使用的旧密钥加密
+	server, err := accept.AcceptKey(base.LevelV2, "k0", old.CbcEncrypt(base.RandBytes(16)), cdc)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if _, err = old.CbcDecrypt(server.ResponseKey()); err != nil {
+		t.Fatalf("want response key encrypted with k0, got %s", err)
+	}
+
+	// 未携带key id时使用primary，不会用到DecryptOnly的密钥
+	primary, _ := ring.Get("")
+	if k1, _ := ring.Get("k1"); primary != k1 {
+		t.Fatalf("want k1, got %v", primary)
+	}
+
+	if _, err = accept.AcceptKey(base.LevelV2, "", aes.CbcEncrypt(base.RandBytes(16)), cdc); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if _, err = accept.AcceptKey(base.LevelV1, "k2", nil, cdc); err != ErrKeyNotFound {
+		t.Fatalf("want %s, got %v", ErrKeyNotFound, err)
+	}
+
+	if err = ring.Load("k0", AesKey{Id: "k0", Key: "0123456789abcdef0123456789abcdef", DecryptOnly: true}); err != ErrPrimaryKey {
+		t.Fatalf("want %s, got %v", ErrPrimaryKey, err)
+	}
+
+	if ring.Primary() != "k1" {
+		t.Fatalf("want k1 kept after failed load, got %s", ring.Primary())
+	}
+}
+
+func TestAead(t *testing.T) {
+	cdc, _ := codec.Get(codec.NameJson)
+	accept := NewAccept(aes, StrengthAead)
+
+	if _, err := accept.Accept(base.LevelV2, aes.CbcEncrypt(base.RandBytes(16)), cdc); err != base.ErrForbidden {
+		t.Fatalf("want %s, got %v", base.ErrForbidden, err)
+	}
+
+	secret, _ := NewAeadSecret()
+	server, err := accept.Accept(LevelAead, aes.CbcEncrypt(secret), cdc)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	client, err := NewAeadForClient(aes, secret, server.ResponseKey())
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	login := &base.Package{Id: base.EventLogin, Name: "login", Param: base.JsonParam{"token": "abc"}}
+	first, second := client.Pack(login), client.Pack(login)
+
+	if _, err = server.Unpack(second); err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if _, err = server.Unpack(first); err != ErrReplay {
+		t.Fatalf("want %s for reordered package, got %v", ErrReplay, err)
+	}
+
+	if _, err = server.Unpack(second); err != ErrReplay {
+		t.Fatalf("want %s for replayed package, got %v", ErrReplay, err)
+	}
+
+	if _, err = server.Unpack(append(client.Pack(login), '=')); err != base.ErrDataFormat {
+		t.Fatalf("want %s, got %v", base.ErrDataFormat, err)
+	}
+
+	third := client.Pack(login)
+	third[5] = '9'
+	if _, err = server.Unpack(third); err == nil {
+		t.Fatalf("want authentication failed, got nil")
+	}
+
+	pkg, err := client.Unpack(server.Pack(login))
+	if err != nil || pkg.Param.String("token") != "abc" {
+		t.Fatalf("want login abc, got %+v %v", pkg, err)
+	}
+
+	if _, err = server.Unpack(client.Pack(login)); err != nil {
+		t.Fatalf("want nil after rejected packages, got %s", err)
+	}
+}
+
+func TestEcdh(t *testing.T) {
+	cdc, _ := codec.Get(codec.NameJson)
+	signKeyFile := filepath.Join(t.TempDir(), "ecdh", "sign.key")
+	if _, err := LoadSignKey(signKeyFile); !os.IsNotExist(err) {
+		t.Fatalf("want not exist, got %v", err)
+	}
+
+	generated, err := GenerateSignKey(signKeyFile)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if _, err = GenerateSignKey(signKeyFile); !os.IsExist(err) {
+		t.Fatalf("want exist, got %v", err)
+	}
+
+	signKey, err := LoadSignKey(signKeyFile)
+	if err != nil || !signKey.Equal(generated) {
+		t.Fatalf("want generated key, got %v", err)
+	}
+
+	accept := NewAccept(aes, StrengthAead)
+	key, _ := NewEcdhKey()
+	if _, err = accept.Accept(LevelEcdh, key.Public, cdc); err != base.ErrForbidden {
+		t.Fatalf("want %s without sign key, got %v", base.ErrForbidden, err)
+	}
+
+	server, err := accept.WithSignKey(signKey).Accept(LevelEcdh, key.Public, cdc)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err = NewEcdhForClient(other.Public().(ed25519.PublicKey), key, server.ResponseKey()); err != ErrSignature {
+		t.Fatalf("want %s, got %v", ErrSignature, err)
+	}
+
+	client, err := NewEcdhForClient(signKey.Public().(ed25519.PublicKey), key, server.ResponseKey())
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	login := &base.Package{Id: base.EventLogin, Name: "login", Param: base.JsonParam{"token": "abc"}}
+	pkg, err := server.Unpack(client.Pack(login))
+	if err != nil || pkg.Param.String("token") != "abc" {
+		t.Fatalf("want login abc, got %+v %v", pkg, err)
+	}
+
+	pkg, err = client.Unpack(server.Pack(login))
+	if err != nil || pkg.Param.String("token") != "abc" {
+		t.Fatalf("want login abc, got %+v %v", pkg, err)
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Bucket 令牌桶，每秒补充rate个令牌，最多burst个，非并发安全，调用方负责加锁
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket 创建令牌桶，初始为满桶，burst小于1时按1处理
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+func (b *Bucket) Allow(now time.Time) bool {
+	return b.AllowN(now, 1)
+}
+
+// AllowN 消耗n个令牌，令牌不足时不消耗并返回false
+func (b *Bucket) AllowN(now time.Time, n float64) bool {
+	b.refill(now)
+
+	if b.tokens < n {
+		return false
+	}
+
+	b.tokens -= n
+	return true
+}
+
+// Take 不检查余量直接消耗n个令牌，令牌可以为负，节流按Delay算出的时间消耗时，
+// 浮点误差可能让补充的令牌略少于n，用AllowN会漏掉这次消耗
+func (b *Bucket) Take(now time.Time, n float64) {
+	b.refill(now)
+	b.tokens -= n
+}
+
+// Full 桶是否已满，满桶说明一段时间没有请求，可以回收
+func (b *Bucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// Delay 距离可以消耗n个令牌还需要等待的时间，n大于burst时永远无法满足，返回-1
+func (b *Bucket) Delay(now time.Time, n float64) time.Duration {
+	if n > b.burst {
+		return -1
+	}
+
+	b.refill(now)
+	if b.tokens >= n && !b.last.After(now) {
+		return 0
+	}
+
+	if b.rate <= 0 {
+		return -1
+	}
+
+	// 节流时会按未来的时间消耗令牌，last可能晚于now
+	var ahead time.Duration
+	if b.last.After(now) {
+		ahead = b.last.Sub(now)
+	}
+
+	if b.tokens >= n {
+		return ahead
+	}
+	return ahead + time.Duration((n-b.tokens)/b.rate*float64(time.Second))
+}
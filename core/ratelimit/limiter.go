@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+type Penalty string
+
+const (
+	// PenaltyDrop 静默丢弃
+	PenaltyDrop Penalty = "drop"
+	// PenaltyError 丢弃并回复EventError
+	PenaltyError Penalty = "error"
+	// PenaltyThrottle 等待令牌后再处理，等待超过MaxDelay时丢弃
+	PenaltyThrottle Penalty = "throttle"
+	// PenaltyDisconnect 丢弃，违规次数达到MaxViolations后断开连接
+	PenaltyDisconnect Penalty = "disconnect"
+)
+
+const (
+	DefaultViolationWindow = time.Minute
+	DefaultMaxDelay        = time.Millisecond * 200
+)
+
+type EventLimit struct {
+	// Rate 每秒次数，不大于0时该事件不单独限制
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+	// Cost 在连接全局令牌桶中消耗的令牌数，默认1
+	Cost float64 `json:"cost"`
+}
+
+type Option struct {
+	// Rate 连接每秒消息数，不大于0时不限制全局速率
+	Rate    float64               `json:"rate"`
+	Burst   int                   `json:"burst"`
+	Events  map[uint16]EventLimit `json:"events"`
+	Penalty Penalty               `json:"penalty"`
+	// MaxViolations ViolationWindow内违规次数达到后断开连接，为0时只有PenaltyDisconnect断开
+	MaxViolations   int           `json:"maxViolations"`
+	ViolationWindow time.Duration `json:"violationWindow"`
+	MaxDelay        time.Duration `json:"maxDelay"`
+}
+
+func (opt *Option) init() {
+	if opt.Penalty == "" {
+		opt.Penalty = PenaltyDrop
+	}
+
+	if opt.Penalty == PenaltyDisconnect && opt.MaxViolations < 1 {
+		opt.MaxViolations = 1
+	}
+
+	if opt.ViolationWindow <= 0 {
+		opt.ViolationWindow = DefaultViolationWindow
+	}
+
+	if opt.MaxDelay <= 0 {
+		opt.MaxDelay = DefaultMaxDelay
+	}
+}
+
+// Result 限流结果，Delay大于0时表示需要等待后处理
+type Result struct {
+	Allowed    bool
+	Delay      time.Duration
+	Penalty    Penalty
+	Disconnect bool
+}
+
+// Limiter 单个连接的入站限流，非并发安全，只在连接所在的event loop中调用
+type Limiter struct {
+	opt        Option
+	global     *Bucket
+	events     map[uint16]*Bucket
+	violations int
+	firstAt    time.Time
+}
+
+func NewLimiter(opt Option) *Limiter {
+	opt.init()
+
+	l := &Limiter{
+		opt:    opt,
+		events: make(map[uint16]*Bucket, len(opt.Events)),
+	}
+
+	if opt.Rate > 0 {
+		l.global = NewBucket(opt.Rate, opt.Burst)
+	}
+
+	for eventId, limit := range opt.Events {
+		if limit.Rate > 0 {
+			l.events[eventId] = NewBucket(limit.Rate, limit.Burst)
+		}
+	}
+
+	return l
+}
+
+func (l *Limiter) cost(eventId uint16) float64 {
+	if limit, exists := l.opt.Events[eventId]; exists && limit.Cost > 0 {
+		return limit.Cost
+	}
+	return 1
+}
+
+// Allow 同时检查全局和事件令牌桶，两者都满足才消耗
+func (l *Limiter) Allow(eventId uint16, now time.Time) Result {
+	var (
+		cost   = l.cost(eventId)
+		event  = l.events[eventId]
+		delay  time.Duration
+		passed = true
+	)
+
+	if l.global != nil {
+		if d := l.global.Delay(now, cost); d != 0 {
+			passed, delay = false, d
+		}
+	}
+
+	if event != nil {
+		if d := event.Delay(now, 1); d != 0 {
+			if d < 0 || (delay >= 0 && d > delay) {
+				delay = d
+			}
+			passed = false
+		}
+	}
+
+	if passed {
+		l.consume(event, cost, now)
+		return Result{Allowed: true}
+	}
+
+	result := Result{Penalty: l.opt.Penalty}
+	if l.opt.Penalty == PenaltyThrottle && delay > 0 && delay <= l.opt.MaxDelay {
+		l.consume(event, cost, now.Add(delay))
+		result.Allowed = true
+		result.Delay = delay
+		return result
+	}
+
+	result.Disconnect = l.violate(now)
+	return result
+}
+
+func (l *Limiter) consume(event *Bucket, cost float64, at time.Time) {
+	if l.global != nil {
+		l.global.Take(at, cost)
+	}
+
+	if event != nil {
+		event.Take(at, 1)
+	}
+}
+
+func (l *Limiter) violate(now time.Time) (disconnect bool) {
+	if l.opt.MaxViolations < 1 {
+		return false
+	}
+
+	if l.violations == 0 || now.Sub(l.firstAt) > l.opt.ViolationWindow {
+		l.violations = 0
+		l.firstAt = now
+	}
+
+	l.violations++
+	return l.violations >= l.opt.MaxViolations
+}
+
+func (l *Limiter) Violations() int {
+	return l.violations
+}
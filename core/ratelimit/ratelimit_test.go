@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := NewLimiter(Option{
+		Rate:          10,
+		Burst:         4,
+		Events:        map[uint16]EventLimit{0x0300: {Rate: 1, Burst: 1, Cost: 2}},
+		Penalty:       PenaltyError,
+		MaxViolations: 2,
+	})
+
+	now := time.Now()
+	if result := l.Allow(0x0300, now); !result.Allowed {
+		t.Fatalf("want allowed, got %+v", result)
+	}
+
+	if result := l.Allow(0x0300, now); result.Allowed || result.Penalty != PenaltyError || result.Disconnect {
+		t.Fatalf("want rejected by event limit, got %+v", result)
+	}
+
+	// 全局桶剩余2个令牌
+	for i := 0; i < 2; i++ {
+		if result := l.Allow(0x0200, now); !result.Allowed {
+			t.Fatalf("want allowed, got %+v", result)
+		}
+	}
+
+	if result := l.Allow(0x0200, now); result.Allowed || !result.Disconnect {
+		t.Fatalf("want disconnect, got %+v", result)
+	}
+}
+
+func TestLimiter_ThrottleConsume(t *testing.T) {
+	// 到达时间有微秒级差异时，每条节流消息都要多等一个令牌的时间
+	for offset := 1; offset < 1000; offset++ {
+		l := NewLimiter(Option{Rate: 10, Burst: 1, Penalty: PenaltyThrottle, MaxDelay: time.Second})
+
+		now := time.Now()
+		for index := 0; index < 4; index++ {
+			result := l.Allow(1, now.Add(time.Duration(offset*index)*time.Microsecond))
+			want := time.Duration(index)*time.Millisecond*100 - time.Duration(offset*index)*time.Microsecond
+			if diff := result.Delay - want; !result.Allowed || diff > time.Millisecond || diff < -time.Millisecond {
+				t.Fatalf("want delay %s, got %+v with offset %dus", want, result, offset)
+			}
+		}
+	}
+}
+
+func TestLimiter_Throttle(t *testing.T) {
+	l := NewLimiter(Option{Rate: 10, Burst: 1, Penalty: PenaltyThrottle, MaxDelay: time.Millisecond * 150})
+
+	now := time.Now()
+	delays := []time.Duration{0, time.Millisecond * 100}
+	for _, want := range delays {
+		result := l.Allow(1, now)
+		if !result.Allowed || result.Delay != want {
+			t.Fatalf("want delay %s, got %+v", want, result)
+		}
+	}
+
+	if result := l.Allow(1, now); result.Allowed {
+		t.Fatalf("want dropped after max delay, got %+v", result)
+	}
+}
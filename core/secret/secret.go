@@ -0,0 +1,282 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/grpc-boot/base"
+)
+
+const (
+	PrefixEnv  = "env:"
+	PrefixFile = "file:"
+	PrefixEnc  = "enc:"
+
+	// SectionKey 值为enc:加密的json对象，解密后合并到params
+	SectionKey = "secrets"
+
+	// EnvMasterKey 解密enc:的32字节主密钥，hex编码，也可以用EnvMasterKeyFile指定文件
+	EnvMasterKey     = "EVENT_MASTER_KEY"
+	EnvMasterKeyFile = "EVENT_MASTER_KEY_FILE"
+
+	Mask = "******"
+)
+
+var (
+	ErrEnvNotSet     = errors.New("secret: env not set")
+	ErrEmpty         = errors.New("secret: empty value")
+	ErrNoMasterKey   = errors.New("secret: master key not set")
+	ErrMasterKey     = errors.New("secret: master key must be 32 bytes hex")
+	ErrCipherText    = errors.New("secret: invalid cipher text")
+	ErrSectionFormat = errors.New("secret: secrets section must be a json object")
+)
+
+// sensitive 以这些名称结尾的key在输出配置时打码
+var sensitive = []string{"key", "keys", "token", "tokens", "password", "secret", SectionKey}
+
+// IsRef 是否为密钥引用
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, PrefixEnv) || strings.HasPrefix(value, PrefixFile) || strings.HasPrefix(value, PrefixEnc)
+}
+
+// MasterKey 从环境变量或文件读取主密钥
+func MasterKey() ([]byte, error) {
+	value := os.Getenv(EnvMasterKey)
+	if value == "" {
+		if file := os.Getenv(EnvMasterKeyFile); file != "" {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			value = strings.TrimSpace(string(data))
+		}
+	}
+
+	if value == "" {
+		return nil, ErrNoMasterKey
+	}
+
+	key, err := hex.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, ErrMasterKey
+	}
+	return key, nil
+}
+
+func newGcm(masterKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt AES-256-GCM加密，返回enc:前缀的配置值
+func Encrypt(masterKey, plain []byte) (string, error) {
+	gcm, err := newGcm(masterKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return PrefixEnc + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func Decrypt(masterKey []byte, value string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, PrefixEnc))
+	if err != nil {
+		return nil, ErrCipherText
+	}
+
+	gcm, err := newGcm(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrCipherText
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCipherText
+	}
+	return plain, nil
+}
+
+// Resolve 解析env:、file:和enc:引用，其他值原样返回，解析结果不能为空
+func Resolve(value string) (string, error) {
+	var (
+		resolved string
+		err      error
+	)
+
+	switch {
+	case strings.HasPrefix(value, PrefixEnv):
+		name := strings.TrimPrefix(value, PrefixEnv)
+		var exists bool
+		if resolved, exists = os.LookupEnv(name); !exists {
+			return "", fmt.Errorf("%w: %s", ErrEnvNotSet, name)
+		}
+	case strings.HasPrefix(value, PrefixFile):
+		// 挂载的secret文件通常以换行结尾
+		var data []byte
+		if data, err = ioutil.ReadFile(strings.TrimPrefix(value, PrefixFile)); err != nil {
+			return "", err
+		}
+		resolved = strings.TrimRight(string(data), "\r\n")
+	case strings.HasPrefix(value, PrefixEnc):
+		var masterKey, plain []byte
+		if masterKey, err = MasterKey(); err != nil {
+			return "", err
+		}
+
+		if plain, err = Decrypt(masterKey, value); err != nil {
+			return "", err
+		}
+		resolved = string(plain)
+	default:
+		return value, nil
+	}
+
+	if resolved == "" {
+		return "", ErrEmpty
+	}
+	return resolved, nil
+}
+
+// ResolveParams 解析params中所有的引用，包括嵌套在数组和对象中的值，返回包含引用的key，错误一次全部返回
+func ResolveParams(params base.JsonParam) (secretKeys []string, err error) {
+	var errs []string
+
+	if secretKeys, err = mergeSection(params); err != nil {
+		errs = append(errs, fmt.Sprintf("%s: %s", SectionKey, err))
+	}
+
+	for key, value := range params {
+		found := false
+		params[key] = resolveValue(value, func(err error) {
+			errs = append(errs, fmt.Sprintf("%s: %s", key, err))
+		}, &found)
+
+		if found && !contains(secretKeys, key) {
+			secretKeys = append(secretKeys, key)
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+
+	sort.Strings(secretKeys)
+	return secretKeys, nil
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSection 加密的secrets对象解密后合并到params，返回合并的key
+func mergeSection(params base.JsonParam) (keys []string, err error) {
+	value, exists := params[SectionKey]
+	if !exists {
+		return nil, nil
+	}
+	delete(params, SectionKey)
+
+	text, ok := value.(string)
+	if !ok {
+		return nil, ErrSectionFormat
+	}
+
+	plain, err := Resolve(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var section map[string]interface{}
+	if err = json.Unmarshal([]byte(plain), &section); err != nil {
+		return nil, ErrSectionFormat
+	}
+
+	for key, item := range section {
+		params[key] = item
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func resolveValue(value interface{}, fail func(err error), found *bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !IsRef(v) {
+			return v
+		}
+
+		*found = true
+		resolved, err := Resolve(v)
+		if err != nil {
+			fail(err)
+			return v
+		}
+		return resolved
+	case []interface{}:
+		for index, item := range v {
+			v[index] = resolveValue(item, fail, found)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = resolveValue(item, fail, found)
+		}
+	}
+	return value
+}
+
+func isSensitive(key string) bool {
+	name := strings.ToLower(key[strings.LastIndexByte(key, '.')+1:])
+	for _, suffix := range sensitive {
+		if name == suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact 返回用于输出的副本，敏感key与secretKeys对应的值替换为Mask
+func Redact(params base.JsonParam, secretKeys ...string) base.JsonParam {
+	masked := make(map[string]bool, len(secretKeys))
+	for _, key := range secretKeys {
+		masked[key] = true
+	}
+
+	redacted := make(base.JsonParam, len(params))
+	for key, value := range params {
+		if masked[key] || isSensitive(key) {
+			redacted[key] = Mask
+			continue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
@@ -0,0 +1,66 @@
+package secret
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grpc-boot/base"
+)
+
+func TestResolveParams(t *testing.T) {
+	masterKey := []byte("0123456789abcdef0123456789abcdef")
+	t.Setenv(EnvMasterKey, hex.EncodeToString(masterKey))
+	t.Setenv("EVENT_TEST_TOKEN", "token-from-env")
+
+	file := filepath.Join(t.TempDir(), "aes.key")
+	_ = ioutil.WriteFile(file, []byte("SD3c523asz7*&^df312c45cDvd4bFc12\n"), 0600)
+
+	aesKey, _ := Encrypt(masterKey, []byte("0123456789abcdef0123456789abcdef"))
+	section, _ := Encrypt(masterKey, []byte(`{"admin.password":"secret"}`))
+
+	params := base.JsonParam{
+		"numLoops":        4,
+		"handshake.token": "env:EVENT_TEST_TOKEN",
+		"aes.keys": []interface{}{
+			map[string]interface{}{"id": "k1", "key": "file:" + file},
+			map[string]interface{}{"id": "k2", "key": aesKey},
+		},
+		SectionKey: section,
+	}
+
+	secretKeys, err := ResolveParams(params)
+	if err != nil {
+		t.Fatalf("want nil, got %s", err)
+	}
+
+	if strings.Join(secretKeys, ",") != "admin.password,aes.keys,handshake.token" {
+		t.Fatalf("want admin.password,aes.keys,handshake.token, got %v", secretKeys)
+	}
+
+	keys := params["aes.keys"].([]interface{})
+	if keys[0].(map[string]interface{})["key"] != "SD3c523asz7*&^df312c45cDvd4bFc12" || keys[1].(map[string]interface{})["key"] != "0123456789abcdef0123456789abcdef" {
+		t.Fatalf("want resolved keys, got %v", keys)
+	}
+
+	if params.String("handshake.token") != "token-from-env" || params.String("admin.password") != "secret" {
+		t.Fatalf("want resolved token and password, got %v", params)
+	}
+
+	redacted := Redact(params, secretKeys...)
+	if redacted["aes.keys"] != Mask || redacted["admin.password"] != Mask || redacted["numLoops"] != 4 {
+		t.Fatalf("want redacted, got %v", redacted)
+	}
+
+	// 所有错误一次返回
+	_, err = ResolveParams(base.JsonParam{
+		"a.key": "env:EVENT_TEST_NOT_SET",
+		"b.key": "file:" + filepath.Join(t.TempDir(), "missing"),
+		"c.key": "enc:bad",
+	})
+	if err == nil || strings.Count(err.Error(), ";") != 2 {
+		t.Fatalf("want 3 errors, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/eventloop"
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultSampleInterval = time.Second
+)
+
+var (
+	ErrServerFull  = errors.New("server: too many conns")
+	ErrOverloaded  = errors.New("server: overloaded")
+	ErrMemoryLimit = errors.New("server: memory over limit")
+)
+
+type AdmissionOption struct {
+	// MaxConns 最大连接数，小于1不限制
+	MaxConns int64 `json:"maxConns"`
+	// MaxMemory 进程占用内存上限(字节)，为0不检查
+	MaxMemory uint64 `json:"maxMemory"`
+	// MaxLag event loop延迟上限，为0不检查
+	MaxLag time.Duration `json:"maxLag"`
+	// SampleInterval 内存和延迟的采样间隔
+	SampleInterval time.Duration `json:"sampleInterval"`
+}
+
+// Admission 准入控制，连接数达到上限或负载过高时拒绝新的握手
+type Admission struct {
+	opt       AdmissionOption
+	maxConns  atomic.Int64
+	maxMemory atomic.Uint64
+	maxLag    atomic.Duration
+	conns     func() int64
+	memory    atomic.Uint64
+	lag       atomic.Duration
+	sampling  atomic.Bool
+	stopOnce  sync.Once
+	done      chan struct{}
+	// probes gev创建连接时记录的event loop
+	probes atomic.Value
+}
+
+// loopProbe 投递到event loop中的任务，queued为尚未执行的任务的投递时间
+type loopProbe struct {
+	loop   *eventloop.EventLoop
+	queued atomic.Int64
+	lag    atomic.Duration
+}
+
+// NewAdmission conns返回当前连接数，一般为Server.TotalConns
+func NewAdmission(opt AdmissionOption, conns func() int64) *Admission {
+	if opt.SampleInterval <= 0 {
+		opt.SampleInterval = defaultSampleInterval
+	}
+
+	a := &Admission{
+		opt:   opt,
+		conns: conns,
+		done:  make(chan struct{}),
+	}
+	a.store(opt)
+	return a
+}
+
+func (a *Admission) store(opt AdmissionOption) {
+	a.maxConns.Store(opt.MaxConns)
+	a.maxMemory.Store(opt.MaxMemory)
+	a.maxLag.Store(opt.MaxLag)
+}
+
+// Balance 包装gev的负载均衡策略，记录event loop用于测量延迟
+func (a *Admission) Balance(strategy gev.LoadBalanceStrategy) gev.LoadBalanceStrategy {
+	return func(loops []*eventloop.EventLoop) *eventloop.EventLoop {
+		if a.probes.Load() == nil {
+			probes := make([]*loopProbe, len(loops))
+			for index, loop := range loops {
+				probes[index] = &loopProbe{loop: loop}
+			}
+			a.probes.Store(probes)
+		}
+		return strategy(loops)
+	}
+}
+
+// Start 开始采样内存和event loop延迟，未设置MaxMemory和MaxLag时不采样
+func (a *Admission) Start() {
+	if a.maxMemory.Load() == 0 && a.maxLag.Load() <= 0 {
+		return
+	}
+
+	if a.sampling.CAS(false, true) {
+		go a.sample()
+	}
+}
+
+// Update 运行时更新上限，SampleInterval不变，新开启内存或延迟检查时开始采样
+func (a *Admission) Update(opt AdmissionOption) {
+	a.store(opt)
+	a.Start()
+}
+
+func (a *Admission) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.done)
+	})
+}
+
+// sample 每次采样向每个event loop投递一个任务，延迟为投递到执行的时间，取各loop的最大值
+func (a *Admission) sample() {
+	ticker := time.NewTicker(a.opt.SampleInterval)
+	defer ticker.Stop()
+
+	var stats runtime.MemStats
+	for {
+		select {
+		case <-a.done:
+			return
+		case now := <-ticker.C:
+			a.lag.Store(a.loopLag(now))
+
+			if a.maxMemory.Load() > 0 {
+				runtime.ReadMemStats(&stats)
+				a.memory.Store(stats.Sys - stats.HeapReleased)
+			}
+		}
+	}
+}
+
+// loopLag 上次的任务还没执行时，延迟至少为投递之后经过的时间
+func (a *Admission) loopLag(now time.Time) (lag time.Duration) {
+	probes, _ := a.probes.Load().([]*loopProbe)
+	for _, probe := range probes {
+		if queued := probe.queued.Load(); queued > 0 {
+			if pending := now.Sub(time.Unix(0, queued)); pending > lag {
+				lag = pending
+			}
+			continue
+		}
+
+		if last := probe.lag.Load(); last > lag {
+			lag = last
+		}
+
+		probe.queued.Store(now.UnixNano())
+		p := probe
+		p.loop.QueueInLoop(func() {
+			p.lag.Store(time.Since(time.Unix(0, p.queued.Load())))
+			p.queued.Store(0)
+		})
+	}
+	return
+}
+
+// Check 连接数包含正在握手的连接
+func (a *Admission) Check() error {
+	if maxConns := a.maxConns.Load(); maxConns > 0 && a.conns != nil && a.conns() > maxConns {
+		return ErrServerFull
+	}
+
+	if maxMemory := a.maxMemory.Load(); maxMemory > 0 && a.memory.Load() > maxMemory {
+		return ErrMemoryLimit
+	}
+
+	if maxLag := a.maxLag.Load(); maxLag > 0 && a.lag.Load() > maxLag {
+		return ErrOverloaded
+	}
+	return nil
+}
+
+func (a *Admission) Memory() uint64 {
+	return a.memory.Load()
+}
+
+func (a *Admission) Lag() time.Duration {
+	return a.lag.Load()
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNoCredential      = errors.New("server: no credential")
+	ErrInvalidCredential = errors.New("server: invalid credential")
+)
+
+// Authorizer 握手鉴权，请求中没有对应凭证时返回ErrNoCredential，交给下一个Authorizer，
+// 凭证对应用户时设置req.UserId，连接建立后即绑定该用户
+type Authorizer interface {
+	Authorize(req *HandshakeRequest) error
+}
+
+type AuthorizerFunc func(req *HandshakeRequest) error
+
+func (af AuthorizerFunc) Authorize(req *HandshakeRequest) error {
+	return af(req)
+}
+
+type TokenVerifier func(token string) bool
+
+// StaticTokens 固定token列表
+func StaticTokens(tokens ...string) TokenVerifier {
+	return func(token string) bool {
+		ok := false
+		for _, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				ok = true
+			}
+		}
+		return ok
+	}
+}
+
+func verifyToken(token string, verify TokenVerifier) error {
+	if token == "" {
+		return ErrNoCredential
+	}
+
+	if !verify(token) {
+		return ErrInvalidCredential
+	}
+	return nil
+}
+
+type queryToken struct {
+	name   string
+	verify TokenVerifier
+}
+
+// NewQueryToken 从query参数name读取token
+func NewQueryToken(name string, verify TokenVerifier) Authorizer {
+	return &queryToken{name: name, verify: verify}
+}
+
+func (qt *queryToken) Authorize(req *HandshakeRequest) error {
+	return verifyToken(req.Query.Get(qt.name), qt.verify)
+}
+
+type headerToken struct {
+	name   string
+	verify TokenVerifier
+}
+
+// NewHeaderToken 从header name读取token，会去掉Bearer前缀
+func NewHeaderToken(name string, verify TokenVerifier) Authorizer {
+	return &headerToken{name: name, verify: verify}
+}
+
+func (ht *headerToken) Authorize(req *HandshakeRequest) error {
+	token := req.Header.Get(ht.name)
+	if len(token) > 7 && strings.EqualFold(token[:7], "Bearer ") {
+		token = token[7:]
+	}
+	return verifyToken(strings.TrimSpace(token), ht.verify)
+}
+
+type cookieToken struct {
+	name   string
+	verify TokenVerifier
+}
+
+// NewCookieToken 从cookie name读取token
+func NewCookieToken(name string, verify TokenVerifier) Authorizer {
+	return &cookieToken{name: name, verify: verify}
+}
+
+func (ct *cookieToken) Authorize(req *HandshakeRequest) error {
+	token, _ := req.Cookie(ct.name)
+	return verifyToken(token, ct.verify)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies 可信代理网段，只有直连地址属于可信代理时才读取X-Forwarded-For/X-Real-IP
+type trustedProxies []*net.IPNet
+
+func parseTrustedProxies(cidrs ...string) (proxies trustedProxies, err error) {
+	proxies = make(trustedProxies, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+func (tp trustedProxies) contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, ipNet := range tp {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIp 从右向左跳过可信代理，第一个不可信的地址即客户端地址
+func (tp trustedProxies) clientIp(peerAddr string, header http.Header) string {
+	ip := peerAddr
+	if host, _, err := net.SplitHostPort(peerAddr); err == nil {
+		ip = host
+	}
+
+	if !tp.contains(ip) {
+		return ip
+	}
+
+	if forwarded := header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for index := len(hops) - 1; index >= 0; index-- {
+			hop := strings.TrimSpace(hops[index])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+
+			ip = hop
+			if !tp.contains(hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+
+	if realIp := strings.TrimSpace(header.Get("X-Real-IP")); net.ParseIP(realIp) != nil {
+		return realIp
+	}
+	return ip
+}
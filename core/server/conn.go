@@ -3,12 +3,21 @@ package server
 import (
 	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"event/core/chunk"
+	"event/core/protocol"
+	"event/core/tracing"
+	"event/core/zapkey"
 
 	"github.com/Allenxuxu/gev"
 	"github.com/Allenxuxu/gev/plugins/websocket/ws"
 	"github.com/Allenxuxu/gev/plugins/websocket/ws/util"
 	"github.com/grpc-boot/base"
 	"github.com/grpc-boot/base/core/zaplogger"
+	"go.uber.org/atomic"
 )
 
 var (
@@ -16,51 +25,244 @@ var (
 )
 
 type Conn struct {
-	first  bool
-	header http.Header
+	first   bool
+	limit   *MessageLimit
+	logger  Logger
+	metrics *Metrics
+	tracer  *tracing.Tracer
+	session session
+	created time.Time
+	// active 最后收到数据的时间，UnixNano
+	active atomic.Int64
 	*gev.Connection
 }
 
-func newConn(conn *gev.Connection) (id uint64, c *Conn) {
+func newConn(conn *gev.Connection, limit *MessageLimit, logger Logger, metrics *Metrics) (id uint64, c *Conn) {
 	id = setId(conn)
 
 	c = &Conn{
 		first:      true,
+		limit:      limit,
+		logger:     logger,
+		metrics:    metrics,
+		created:    time.Now(),
 		Connection: conn,
 	}
+	c.active.Store(c.created.UnixNano())
 
 	return
 }
 
+// Logger 所属Server的日志，自动附加连接id、地址、协议级别和绑定的用户id
+func (c *Conn) Logger() Logger {
+	if c.logger == nopLogger {
+		return c.logger
+	}
+	return connLogger{logger: c.logger, c: c.Connection, conn: c}
+}
+
+// Metrics 所属Server的指标，未开启时为nil，方法可以直接调用
+func (c *Conn) Metrics() *Metrics {
+	return c.metrics
+}
+
+// Tracer 所属Server的Tracer，未开启时为nil，方法可以直接调用
+func (c *Conn) Tracer() *tracing.Tracer {
+	return c.tracer
+}
+
 func (c *Conn) GetId() (id uint64, exists bool) {
 	return GetId(c.Connection)
 }
 
+func (c *Conn) request() *HandshakeRequest {
+	req, exists := getRequest(c.Connection)
+	if !exists {
+		return &HandshakeRequest{}
+	}
+	return req
+}
+
+// Uri 握手请求的uri，包含query
+func (c *Conn) Uri() string {
+	return c.request().Uri
+}
+
+func (c *Conn) Path() string {
+	uri := c.request().Uri
+	if index := strings.IndexByte(uri, '?'); index > -1 {
+		return uri[:index]
+	}
+	return uri
+}
+
+func (c *Conn) Query() url.Values {
+	return c.request().Query
+}
+
+func (c *Conn) QueryValue(key string) string {
+	return c.request().Query.Get(key)
+}
+
+// Header 握手请求中被选择保留的header
+func (c *Conn) Header(key string) string {
+	return c.request().Header.Get(key)
+}
+
+func (c *Conn) Headers() http.Header {
+	return c.request().Header.Clone()
+}
+
+// Level 握手时协商的协议级别
+func (c *Conn) Level() uint8 {
+	return c.request().Level
+}
+
+// PeerAddr 经过tls转发时为tls客户端的地址，不是gev看到的回环地址
+func (c *Conn) PeerAddr() string {
+	return remoteAddr(c.Connection)
+}
+
+// ClientIp 客户端真实ip，经过可信代理时取X-Forwarded-For/X-Real-IP
+func (c *Conn) ClientIp() string {
+	return c.request().ClientIp
+}
+
 func (c *Conn) Unpack(data []byte) (pkg *base.Package, err error) {
 	proto, exists := c.Get(Protocol)
 	if !exists {
 		return nil, ErrProtocolNotExists
 	}
 
-	return proto.(base.Protocol).Unpack(data)
+	if err = c.limit.checkMessage(len(data)); err != nil {
+		tooBig(c.logger, c.metrics, c.Connection, err)
+		return nil, err
+	}
+
+	// 明文json在解码之前检查param，加密和二进制协议只能解码后检查
+	checked := false
+	if c.plain(proto.(base.Protocol)) {
+		if checked, err = c.limit.checkRaw(data); err != nil {
+			tooBig(c.logger, c.metrics, c.Connection, err)
+			return nil, err
+		}
+	}
+
+	if pkg, err = proto.(base.Protocol).Unpack(data); err != nil {
+		c.metrics.Drop(DropUnpack)
+		return nil, err
+	}
+
+	if !checked {
+		if err = c.limit.checkParam(pkg.Param); err != nil {
+			tooBig(c.logger, c.metrics, c.Connection, err)
+			return nil, err
+		}
+	}
+
+	c.metrics.messageIn(pkg.Id)
+	return pkg, nil
 }
 
-func (c *Conn) Emit(pkg *base.Package) error {
+func (c *Conn) plain(proto base.Protocol) bool {
+	return !protocol.IsBinary(proto) && !protocol.Encrypted(c.Level())
+}
+
+// CheckPackage 按MaxAssembledSize和MaxDepth检查合并分片后的json包，超过时以1009关闭连接
+func (c *Conn) CheckPackage(data []byte) error {
+	limit := c.limit.assembled()
+	err := limit.checkMessage(len(data))
+	if err == nil {
+		// 分片合并后总是json，不是json时由Unpack返回错误
+		_, err = limit.checkRaw(data)
+	}
+
+	if err != nil {
+		tooBig(c.logger, c.metrics, c.Connection, err)
+	}
+	return err
+}
+
+// Emit 包中带有trace context且开启tracing时创建event.emit span
+func (c *Conn) Emit(pkg *base.Package) (err error) {
+	if span, traced := traceEmit(c, pkg); traced {
+		defer func() {
+			tracing.End(span, err)
+		}()
+	}
+	return c.emit(pkg)
+}
+
+func (c *Conn) emit(pkg *base.Package) error {
 	proto, exists := c.Get(Protocol)
 	if !exists {
 		return ErrProtocolNotExists
 	}
 
+	// 带序号的协议在锁内打包并入队，gev按入队顺序发送
+	if sequenced, ok := proto.(protocol.Sequenced); ok {
+		mutex := sequenced.SendMutex()
+		mutex.Lock()
+		defer mutex.Unlock()
+	}
+
 	data := proto.(base.Protocol).Pack(pkg)
+	if data == nil {
+		c.Logger().Error("pack msg failed",
+			zaplogger.Error(protocol.ErrPack),
+			zapkey.Package(pkg),
+		)
+		return protocol.ErrPack
+	}
+
+	c.metrics.messageOut(pkg.Id)
+	if protocol.IsBinary(proto.(base.Protocol)) {
+		return c.SendBinary(data)
+	}
 	return c.SendText(data)
 }
 
+// EmitChunked 超过chunkSize的包拆分为多个分片发送，chunkSize小于1时使用默认值
+func (c *Conn) EmitChunked(pkg *base.Package, chunkSize int, progress chunk.Progress) error {
+	return chunk.Send(pkg, chunkSize, c.Emit, progress)
+}
+
+func (c *Conn) deflater() (d *deflater, exists bool) {
+	value, exists := c.Get(Compress)
+	if !exists {
+		return nil, false
+	}
+
+	return value.(*deflater), true
+}
+
+func (c *Conn) sendCompressed(d *deflater, messageType ws.MessageType, data []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	msg, err := d.pack(messageType, data)
+	if err != nil {
+		c.Logger().Error("pack compressed msg failed",
+			zaplogger.Error(err),
+			zapkey.Size(len(data)),
+		)
+		return err
+	}
+
+	return c.Send(msg)
+}
+
 func (c *Conn) SendText(text []byte) error {
+	c.metrics.send(len(text))
+	if d, exists := c.deflater(); exists && len(text) >= d.minSize {
+		return c.sendCompressed(d, ws.MessageText, text)
+	}
+
 	msg, err := util.PackData(ws.MessageText, text)
 	if err != nil {
-		base.ZapError("pack text msg failed",
+		c.Logger().Error("pack text msg failed",
 			zaplogger.Error(err),
-			zaplogger.Value(text),
+			zapkey.Size(len(text)),
 		)
 		return err
 	}
@@ -69,21 +271,31 @@ func (c *Conn) SendText(text []byte) error {
 }
 
 func (c *Conn) SendBinary(data []byte) error {
+	c.metrics.send(len(data))
+	if d, exists := c.deflater(); exists && len(data) >= d.minSize {
+		return c.sendCompressed(d, ws.MessageBinary, data)
+	}
+
 	msg, err := util.PackData(ws.MessageBinary, data)
 	if err != nil {
-		base.ZapError("pack binary msg failed",
+		c.Logger().Error("pack binary msg failed",
 			zaplogger.Error(err),
-			zaplogger.Value(data),
+			zapkey.Size(len(data)),
 		)
 		return err
 	}
 	return c.Send(msg)
 }
 
+// CloseWithStatus 发送带状态码的关闭帧后关闭写端
+func (c *Conn) CloseWithStatus(code ws.StatusCode, reason string) {
+	closeWithStatus(c.Connection, code, reason)
+}
+
 func (c *Conn) SendClose(reason string) error {
-	msg, err := util.PackCloseData(reason)
+	msg, err := util.PackCloseData(truncateReason(reason))
 	if err != nil {
-		base.ZapError("pack close msg failed",
+		c.Logger().Error("pack close msg failed",
 			zaplogger.Error(err),
 			zaplogger.Value(reason),
 		)
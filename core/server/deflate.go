@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/gobwas/httphead"
+)
+
+const (
+	extensionDeflate = "permessage-deflate"
+
+	paramServerNoContextTakeover = "server_no_context_takeover"
+	paramClientNoContextTakeover = "client_no_context_takeover"
+	paramServerMaxWindowBits     = "server_max_window_bits"
+	paramClientMaxWindowBits     = "client_max_window_bits"
+
+	maxWindowBits = 15
+	windowSize    = 1 << maxWindowBits
+
+	// rsv1 permessage-deflate压缩标记，对应ws.Header.Rsv1
+	rsv1 = 0x4
+)
+
+var (
+	ErrDeflateNotNegotiated = errors.New("permessage-deflate not negotiated")
+)
+
+var (
+	// 同步刷新标记以及一个空的final块，便于flate.Reader正常结束
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+)
+
+type DeflateOption struct {
+	Enable                  bool `json:"enable"`
+	Level                   int  `json:"level"`
+	MinSize                 int  `json:"minSize"`
+	ServerNoContextTakeover bool `json:"serverNoContextTakeover"`
+	ClientNoContextTakeover bool `json:"clientNoContextTakeover"`
+}
+
+type Compression struct {
+	opt DeflateOption
+}
+
+func NewCompression(opt DeflateOption) *Compression {
+	if opt.Level < flate.HuffmanOnly || opt.Level > flate.BestCompression {
+		opt.Level = flate.DefaultCompression
+	}
+
+	return &Compression{opt: opt}
+}
+
+// Negotiate 用作ws.Upgrader.ExtensionCustom，协商permessage-deflate
+func (cp *Compression) Negotiate(c *gev.Connection, header []byte, selected []httphead.Option) ([]httphead.Option, bool) {
+	if !cp.opt.Enable {
+		return selected, true
+	}
+
+	for _, option := range selected {
+		if string(option.Name) == extensionDeflate {
+			return selected, true
+		}
+	}
+
+	offers, ok := httphead.ParseOptions(header, nil)
+	if !ok {
+		return selected, false
+	}
+
+	for _, offer := range offers {
+		if string(offer.Name) != extensionDeflate {
+			continue
+		}
+
+		params, d, accepted := cp.accept(offer)
+		if !accepted {
+			continue
+		}
+
+		c.Set(Compress, d)
+		return append(selected, httphead.NewOption(extensionDeflate, params)), true
+	}
+
+	return selected, true
+}
+
+func (cp *Compression) accept(offer httphead.Option) (params map[string]string, d *deflater, accepted bool) {
+	var (
+		serverNoContextTakeover = cp.opt.ServerNoContextTakeover
+		clientNoContextTakeover = cp.opt.ClientNoContextTakeover
+		seen                    = map[string]bool{}
+	)
+
+	params = map[string]string{}
+	accepted = true
+
+	offer.Parameters.ForEach(func(k, v []byte) bool {
+		key := string(k)
+		if seen[key] {
+			accepted = false
+			return false
+		}
+		seen[key] = true
+
+		switch key {
+		case paramServerNoContextTakeover:
+			serverNoContextTakeover = true
+		case paramClientNoContextTakeover:
+			clientNoContextTakeover = true
+		case paramServerMaxWindowBits:
+			// flate固定使用32K窗口，无法满足更小的窗口要求
+			if bits, err := strconv.Atoi(string(v)); err != nil || bits != maxWindowBits {
+				accepted = false
+				return false
+			}
+			params[paramServerMaxWindowBits] = string(v)
+		case paramClientMaxWindowBits:
+			if len(v) > 0 {
+				if bits, err := strconv.Atoi(string(v)); err != nil || bits < 8 || bits > maxWindowBits {
+					accepted = false
+					return false
+				}
+			}
+		default:
+			accepted = false
+			return false
+		}
+		return true
+	})
+
+	if !accepted {
+		return nil, nil, false
+	}
+
+	if serverNoContextTakeover {
+		params[paramServerNoContextTakeover] = ""
+	}
+
+	if clientNoContextTakeover {
+		params[paramClientNoContextTakeover] = ""
+	}
+
+	d = &deflater{
+		level:                   cp.opt.Level,
+		minSize:                 cp.opt.MinSize,
+		serverNoContextTakeover: serverNoContextTakeover,
+		clientNoContextTakeover: clientNoContextTakeover,
+	}
+	return params, d, true
+}
+
+// deflater 单个连接的压缩状态，写端可能被多个协程调用，读端只在event loop中调用
+type deflater struct {
+	mutex                   sync.Mutex
+	level                   int
+	minSize                 int
+	serverNoContextTakeover bool
+	clientNoContextTakeover bool
+
+	writer *flate.Writer
+	buf    bytes.Buffer
+
+	reader io.ReadCloser
+	window []byte
+}
+
+// pack 压缩并封装为websocket帧，调用方需持有mutex以保证压缩顺序与发送顺序一致
+func (d *deflater) pack(messageType ws.MessageType, data []byte) ([]byte, error) {
+	payload, err := d.compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	op := ws.OpText
+	if messageType == ws.MessageBinary {
+		op = ws.OpBinary
+	}
+
+	frame := ws.NewFrame(op, true, payload)
+	frame.Header.Rsv = rsv1
+	return ws.FrameToBytes(frame)
+}
+
+func (d *deflater) compress(data []byte) (out []byte, err error) {
+	d.buf.Reset()
+
+	if d.writer == nil {
+		if d.writer, err = flate.NewWriter(&d.buf, d.level); err != nil {
+			return nil, err
+		}
+	} else if d.serverNoContextTakeover {
+		d.writer.Reset(&d.buf)
+	}
+
+	if _, err = d.writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err = d.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	// 去掉同步刷新产生的0x00 0x00 0xff 0xff
+	out = d.buf.Bytes()
+	if len(out) >= 4 {
+		out = out[:len(out)-4]
+	}
+
+	return append([]byte(nil), out...), nil
+}
+
+// decompress maxSize大于0时限制解压后的长度，避免压缩炸弹
+func (d *deflater) decompress(data []byte, maxSize int) (out []byte, err error) {
+	var dict []byte
+	if !d.clientNoContextTakeover {
+		dict = d.window
+	}
+
+	src := io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail))
+	if d.reader == nil {
+		d.reader = flate.NewReaderDict(src, dict)
+	} else if err = d.reader.(flate.Resetter).Reset(src, dict); err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = d.reader
+	if maxSize > 0 {
+		reader = io.LimitReader(d.reader, int64(maxSize)+1)
+	}
+
+	if out, err = ioutil.ReadAll(reader); err != nil {
+		return nil, err
+	}
+
+	if maxSize > 0 && len(out) > maxSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	if !d.clientNoContextTakeover {
+		d.window = append(d.window, out...)
+		if len(d.window) > windowSize {
+			d.window = append(d.window[:0], d.window[len(d.window)-windowSize:]...)
+		}
+	}
+
+	return out, nil
+}
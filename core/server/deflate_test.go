@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gobwas/httphead"
+)
+
+func TestCompression_Accept(t *testing.T) {
+	cp := NewCompression(DeflateOption{Enable: true, Level: 1})
+
+	offers, _ := httphead.ParseOptions([]byte("permessage-deflate; server_max_window_bits=10, permessage-deflate; client_max_window_bits"), nil)
+	if _, _, accepted := cp.accept(offers[0]); accepted {
+		t.Fatalf("want declined, got accepted")
+	}
+
+	params, d, accepted := cp.accept(offers[1])
+	if !accepted {
+		t.Fatalf("want accepted, got declined")
+	}
+
+	if len(params) != 0 || d.serverNoContextTakeover || d.clientNoContextTakeover {
+		t.Fatalf("want context takeover, got %v", params)
+	}
+}
+
+func TestDeflater_ContextTakeover(t *testing.T) {
+	for _, noContextTakeover := range []bool{false, true} {
+		var (
+			server = &deflater{level: 1, serverNoContextTakeover: noContextTakeover}
+			client = &deflater{level: 1, clientNoContextTakeover: noContextTakeover}
+			msg    = bytes.Repeat([]byte(`{"id":768,"name":"message","param":{"current":1}}`), 8)
+		)
+
+		for index := 0; index < 3; index++ {
+			data, err := server.compress(msg)
+			if err != nil {
+				t.Fatalf("want nil, got %s", err)
+			}
+
+			out, err := client.decompress(data, 0)
+			if err != nil {
+				t.Fatalf("want nil, got %s", err)
+			}
+
+			if !bytes.Equal(out, msg) {
+				t.Fatalf("want %s, got %s", msg, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"event/core/codec"
+	"event/core/protocol"
+	"event/core/tracing"
+	"event/core/zapkey"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws/util"
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+	"go.uber.org/atomic"
+)
+
+const (
+	Request = "ws:request"
+
+	admittedKey = "ws:admitted"
+	rejectedKey = "ws:rejected"
+)
+
+type Reason string
+
+const (
+	ReasonBadRequest   Reason = "bad_request"
+	ReasonOrigin       Reason = "bad_origin"
+	ReasonUnauthorized Reason = "unauthorized"
+	ReasonCodec        Reason = "bad_codec"
+	ReasonAccept       Reason = "accept_failed"
+	ReasonInternal     Reason = "internal"
+	ReasonIpRate       Reason = "ip_rate_limited"
+	ReasonIpConns      Reason = "ip_too_many_conns"
+	ReasonServerFull   Reason = "server_full"
+	ReasonOverloaded   Reason = "overloaded"
+	ReasonTLSRequired  Reason = "tls_required"
+)
+
+// Rejection 握手拒绝原因，Status为返回给客户端的http状态码
+type Rejection struct {
+	Reason Reason
+	Status int
+	Err    error
+}
+
+func (r *Rejection) Error() string {
+	if r.Err == nil {
+		return string(r.Reason)
+	}
+	return string(r.Reason) + ": " + r.Err.Error()
+}
+
+// HandshakeRequest 握手请求信息，握手期间逐步填充，握手成功后Header只保留WithHeaders选择的header
+type HandshakeRequest struct {
+	Uri  string
+	Host string
+	// PeerAddr 直连地址，经过tls转发时为tls客户端的地址
+	PeerAddr string
+	ClientIp string
+	Level    uint8
+	Query    url.Values
+	Header   http.Header
+	// UserId Authorizer鉴权通过后设置的用户id
+	UserId string
+}
+
+func (hr *HandshakeRequest) Cookie(name string) (value string, exists bool) {
+	req := http.Request{Header: hr.Header}
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+type Handshake struct {
+	accept      *protocol.Accept
+	origins     []string
+	authorizers []Authorizer
+	proxies     trustedProxies
+	headers     []string
+	limiter     *IpLimiter
+	admission   *Admission
+	peer        func(addr string) (string, bool)
+	rejections  sync.Map
+	logger      Logger
+	metrics     *Metrics
+	tracer      *tracing.Tracer
+}
+
+func NewHandshake(accept *protocol.Accept) *Handshake {
+	return &Handshake{accept: accept, logger: nopLogger}
+}
+
+// WithOrigins 允许的Origin，支持*和*.example.com，为空时不检查
+func (h *Handshake) WithOrigins(origins ...string) {
+	h.origins = append(h.origins, origins...)
+}
+
+// WithAuthorizer 追加Authorizer，按添加顺序检查
+func (h *Handshake) WithAuthorizer(authorizers ...Authorizer) {
+	h.authorizers = append(h.authorizers, authorizers...)
+}
+
+// WithTrustedProxies 可信代理，支持ip和cidr
+func (h *Handshake) WithTrustedProxies(cidrs ...string) error {
+	proxies, err := parseTrustedProxies(cidrs...)
+	if err != nil {
+		return err
+	}
+
+	h.proxies = append(h.proxies, proxies...)
+	return nil
+}
+
+// WithHeaders 握手成功后保留到Conn上的header
+func (h *Handshake) WithHeaders(names ...string) {
+	for _, name := range names {
+		h.headers = append(h.headers, http.CanonicalHeaderKey(name))
+	}
+}
+
+// WithIpLimiter 在校验Origin、鉴权和AcceptHex之前按ip限流
+func (h *Handshake) WithIpLimiter(limiter *IpLimiter) {
+	h.limiter = limiter
+}
+
+// WithAdmission 连接数或负载超过阈值时拒绝握手，在ip限流之前检查
+func (h *Handshake) WithAdmission(admission *Admission) {
+	h.admission = admission
+}
+
+// Bind 设置upgrader的握手回调
+func (h *Handshake) Bind(upgrader *ws.Upgrader) {
+	upgrader.OnRequest = h.OnRequest
+	upgrader.OnHost = h.OnHost
+	upgrader.OnHeader = h.OnHeader
+	upgrader.OnBeforeUpgrade = h.OnBeforeUpgrade
+}
+
+// Rejections 各原因的拒绝次数
+func (h *Handshake) Rejections() map[Reason]uint64 {
+	counts := make(map[Reason]uint64)
+	h.rejections.Range(func(key, value interface{}) bool {
+		counts[key.(Reason)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
+
+// OnRequest OnRequest返回错误时upgrader不会写响应，所以先记下错误，在OnBeforeUpgrade中拒绝
+func (h *Handshake) OnRequest(c *gev.Connection, uri []byte) error {
+	if h.tracer.Enabled() {
+		c.Set(handshakeStartKey, time.Now())
+	}
+
+	urlInfo, err := url.ParseRequestURI(string(uri))
+	if err != nil {
+		c.Set(rejectedKey, &Rejection{Reason: ReasonBadRequest, Status: http.StatusBadRequest, Err: err})
+		return nil
+	}
+
+	c.Set(Request, &HandshakeRequest{
+		Uri:    urlInfo.RequestURI(),
+		Query:  urlInfo.Query(),
+		Header: http.Header{},
+	})
+	return nil
+}
+
+func (h *Handshake) OnHost(c *gev.Connection, host []byte) error {
+	if req, exists := getRequest(c); exists {
+		req.Host = string(host)
+	}
+	return nil
+}
+
+func (h *Handshake) OnHeader(c *gev.Connection, key, value []byte) error {
+	if req, exists := getRequest(c); exists {
+		req.Header.Add(string(key), string(value))
+	}
+	return nil
+}
+
+func (h *Handshake) OnBeforeUpgrade(c *gev.Connection) (header ws.HandshakeHeader, err error) {
+	if rejection, rejected := c.Get(rejectedKey); rejected {
+		return nil, h.reject(c, rejection.(*Rejection))
+	}
+
+	req, exists := getRequest(c)
+	if !exists {
+		return nil, h.reject(c, &Rejection{Reason: ReasonInternal, Status: http.StatusInternalServerError})
+	}
+
+	// 开启tls时gev只应收到转发的连接，直连回环端口会绕过tls和客户端证书校验
+	peerAddr, ok := h.peerAddr(c)
+	if !ok {
+		return nil, h.reject(c, &Rejection{Reason: ReasonTLSRequired, Status: http.StatusForbidden})
+	}
+
+	if h.admission != nil {
+		if err = h.admission.Check(); err != nil {
+			reason := ReasonOverloaded
+			if err == ErrServerFull {
+				reason = ReasonServerFull
+			}
+			return nil, h.reject(c, &Rejection{Reason: reason, Status: http.StatusServiceUnavailable, Err: err})
+		}
+	}
+
+	req.PeerAddr = peerAddr
+	req.ClientIp = h.proxies.clientIp(peerAddr, req.Header)
+
+	if err = h.admit(c, req.ClientIp); err != nil {
+		return nil, err
+	}
+
+	if !h.checkOrigin(req.Header.Get("Origin")) {
+		return nil, h.reject(c, &Rejection{Reason: ReasonOrigin, Status: http.StatusForbidden})
+	}
+
+	if err = h.authorize(req); err != nil {
+		return nil, h.reject(c, &Rejection{Reason: ReasonUnauthorized, Status: http.StatusUnauthorized, Err: err})
+	}
+
+	l, _ := strconv.Atoi(req.Query.Get("l"))
+	level := uint8(l)
+
+	cdc, err := codec.Get(req.Query.Get("c"))
+	if err != nil {
+		return nil, h.reject(c, &Rejection{Reason: ReasonCodec, Status: http.StatusBadRequest, Err: err})
+	}
+
+	proto, err := h.accept.AcceptHex(level, req.Query.Get("kid"), []byte(req.Query.Get("k")), cdc)
+	if err != nil {
+		return nil, h.reject(c, &Rejection{Reason: ReasonAccept, Status: http.StatusBadRequest, Err: err})
+	}
+
+	if protocol.HasResponse(level) {
+		if err = sendConnectSuccess(h.logger, c, proto); err != nil {
+			return nil, h.reject(c, &Rejection{Reason: ReasonInternal, Status: http.StatusInternalServerError, Err: err})
+		}
+	}
+
+	h.metrics.handshake(HandshakeOk, requestLevel(c))
+	traceHandshake(h.tracer, c, HandshakeOk, nil)
+	req.Level = level
+	req.Header = h.selectHeaders(req.Header)
+	c.Set(Protocol, proto)
+	return ws.HandshakeHeaderString(""), nil
+}
+
+func (h *Handshake) admit(c *gev.Connection, ip string) error {
+	if h.limiter == nil {
+		return nil
+	}
+
+	counted, err := h.limiter.Admit(ip)
+	switch err {
+	case nil:
+	case ErrIpRateLimited:
+		return h.reject(c, &Rejection{Reason: ReasonIpRate, Status: http.StatusTooManyRequests, Err: err})
+	default:
+		return h.reject(c, &Rejection{Reason: ReasonIpConns, Status: http.StatusTooManyRequests, Err: err})
+	}
+
+	if counted {
+		c.Set(admittedKey, ip)
+	}
+	return nil
+}
+
+// release 归还ip连接名额，握手被拒绝或连接关闭时调用
+func (h *Handshake) release(c *gev.Connection) {
+	value, exists := c.Get(admittedKey)
+	if !exists {
+		return
+	}
+
+	c.Delete(admittedKey)
+	h.limiter.Release(value.(string))
+}
+
+func (h *Handshake) selectHeaders(header http.Header) http.Header {
+	selected := make(http.Header, len(h.headers))
+	for _, name := range h.headers {
+		if values, exists := header[name]; exists {
+			selected[name] = values
+		}
+	}
+	return selected
+}
+
+func (h *Handshake) checkOrigin(origin string) bool {
+	if len(h.origins) < 1 || origin == "" {
+		return true
+	}
+
+	originUrl, err := url.Parse(origin)
+	if err != nil || originUrl.Host == "" {
+		return false
+	}
+
+	host := strings.ToLower(originUrl.Hostname())
+	for _, allowed := range h.origins {
+		allowed = strings.ToLower(allowed)
+		switch {
+		case allowed == "*":
+			return true
+		case strings.HasPrefix(allowed, "*."):
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		case strings.Contains(allowed, "://"):
+			if strings.EqualFold(origin, allowed) {
+				return true
+			}
+		case host == allowed:
+			return true
+		}
+	}
+	return false
+}
+
+// authorize 未设置Authorizer时放行，否则第一个携带凭证的Authorizer决定结果
+func (h *Handshake) authorize(req *HandshakeRequest) error {
+	if len(h.authorizers) < 1 {
+		return nil
+	}
+
+	for _, authorizer := range h.authorizers {
+		err := authorizer.Authorize(req)
+		if err == ErrNoCredential {
+			continue
+		}
+		return err
+	}
+	return ErrNoCredential
+}
+
+func (h *Handshake) reject(c *gev.Connection, rejection *Rejection) error {
+	value, _ := h.rejections.LoadOrStore(rejection.Reason, atomic.NewUint64(0))
+	value.(*atomic.Uint64).Inc()
+
+	h.release(c)
+	h.metrics.handshake(string(rejection.Reason), requestLevel(c))
+	traceHandshake(h.tracer, c, string(rejection.Reason), rejection)
+	setCloseReason(c, CloseHandshake)
+
+	h.logger.Warn("handshake rejected",
+		zapkey.Reason(string(rejection.Reason)),
+		zapkey.Address(remoteAddr(c)),
+		zaplogger.Ip(h.rejectedIp(c)),
+		zaplogger.Error(rejection),
+		zaplogger.Event("handshake"),
+	)
+
+	return ws.RejectConnectionError(
+		ws.RejectionStatus(rejection.Status),
+		ws.RejectionReason(string(rejection.Reason)),
+	)
+}
+
+func (h *Handshake) rejectedIp(c *gev.Connection) string {
+	if req, exists := getRequest(c); exists && req.ClientIp != "" {
+		return req.ClientIp
+	}
+	if peerAddr, ok := h.peerAddr(c); ok {
+		return h.proxies.clientIp(peerAddr, http.Header{})
+	}
+	return h.proxies.clientIp(c.PeerAddr(), http.Header{})
+}
+
+// peerAddr 经过tls转发时gev看到的是回环地址，需要换成客户端地址，查不到时ok为false
+func (h *Handshake) peerAddr(c *gev.Connection) (addr string, ok bool) {
+	if h.peer != nil {
+		return h.peer(c.PeerAddr())
+	}
+	return c.PeerAddr(), true
+}
+
+// remoteAddr 握手时解析的客户端地址，握手之前为gev的直连地址
+func remoteAddr(c *gev.Connection) string {
+	if req, exists := getRequest(c); exists && req.PeerAddr != "" {
+		return req.PeerAddr
+	}
+	return c.PeerAddr()
+}
+
+// requestLevel 握手请求中的协议级别，用作指标标签，非法值统一为invalid
+func requestLevel(c *gev.Connection) string {
+	req, exists := getRequest(c)
+	if !exists {
+		return "invalid"
+	}
+
+	value := req.Query.Get("l")
+	if value == "" {
+		return "0"
+	}
+
+	l, err := strconv.Atoi(value)
+	if err != nil || l < 0 || l > protocol.LevelEcdh {
+		return "invalid"
+	}
+	return strconv.Itoa(l)
+}
+
+func getRequest(c *gev.Connection) (req *HandshakeRequest, exists bool) {
+	value, exists := c.Get(Request)
+	if !exists {
+		return nil, false
+	}
+	return value.(*HandshakeRequest), true
+}
+
+func sendConnectSuccess(logger Logger, c *gev.Connection, proto base.Protocol) error {
+	pkg := &base.Package{
+		Id:   base.EventConnectSuccess,
+		Name: "connect success",
+		Param: base.JsonParam{
+			"data": nil,
+		},
+	}
+
+	k := proto.ResponseKey()
+	if len(k) > 0 {
+		pkg.Param["data"] = k
+	}
+
+	text := pkg.Pack()
+	msg, err := util.PackData(ws.MessageText, text)
+	if err != nil {
+		withConn(logger, c).Error("pack text msg failed",
+			zaplogger.Error(err),
+			zapkey.Size(len(text)),
+		)
+		return err
+	}
+
+	if err = c.Send(msg); err != nil {
+		withConn(logger, c).Error("send connect success failed",
+			zaplogger.Error(err),
+			zapkey.Size(len(text)),
+		)
+		return err
+	}
+	return nil
+}
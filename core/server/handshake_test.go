@@ -0,0 +1,231 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/eventloop"
+)
+
+func TestHandshake_Authorize(t *testing.T) {
+	h := NewHandshake(nil)
+
+	verify := StaticTokens("t1")
+	h.WithAuthorizer(NewQueryToken("token", verify), NewHeaderToken("Authorization", verify), NewCookieToken("token", verify))
+
+	cases := []struct {
+		query  string
+		header http.Header
+		want   error
+	}{
+		{query: "l=0", header: http.Header{}, want: ErrNoCredential},
+		{query: "token=t1", header: http.Header{}, want: nil},
+		{query: "token=t2", header: http.Header{"Authorization": {"Bearer t1"}}, want: ErrInvalidCredential},
+		{query: "l=0", header: http.Header{"Authorization": {"Bearer t1"}}, want: nil},
+		{query: "l=0", header: http.Header{"Cookie": {"a=b; token=t1"}}, want: nil},
+		{query: "l=0", header: http.Header{"Cookie": {"token=t2"}}, want: ErrInvalidCredential},
+	}
+
+	for _, c := range cases {
+		query, _ := url.ParseQuery(c.query)
+		if err := h.authorize(&HandshakeRequest{Query: query, Header: c.header}); err != c.want {
+			t.Fatalf("want %v, got %v with %s %v", c.want, err, c.query, c.header)
+		}
+	}
+}
+
+func TestHandshake_AuthorizeUser(t *testing.T) {
+	h := NewHandshake(nil)
+	h.WithAuthorizer(AuthorizerFunc(func(req *HandshakeRequest) error {
+		if req.Query.Get("token") != "t1" {
+			return ErrNoCredential
+		}
+
+		req.UserId = "u1"
+		return nil
+	}))
+
+	req := &HandshakeRequest{Query: url.Values{"token": {"t1"}}}
+	if err := h.authorize(req); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	c := &gev.Connection{}
+	c.Set(Request, req)
+	_, conn := newConn(c, &MessageLimit{}, nopLogger, nil)
+	if got := conn.UserId(); got != "u1" {
+		t.Fatalf("want u1, got %s", got)
+	}
+
+	conn.Bind("")
+	if got := conn.UserId(); got != "" {
+		t.Fatalf("want unbound, got %s", got)
+	}
+}
+
+func TestHandshake_CheckOrigin(t *testing.T) {
+	h := NewHandshake(nil)
+	if !h.checkOrigin("http://evil.com") {
+		t.Fatalf("want allowed without origins, got rejected")
+	}
+
+	h.WithOrigins("example.com", "*.example.org", "https://app.test")
+
+	cases := map[string]bool{
+		"":                        true,
+		"http://example.com":      true,
+		"https://example.com:443": true,
+		"https://a.example.org":   true,
+		"https://example.org":     false,
+		"https://app.test":        true,
+		"http://app.test":         false,
+		"http://evil.com":         false,
+		"null":                    false,
+	}
+
+	for origin, want := range cases {
+		if got := h.checkOrigin(origin); got != want {
+			t.Fatalf("want %v, got %v with %s", want, got, origin)
+		}
+	}
+}
+
+func TestTrustedProxies_ClientIp(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	cases := []struct {
+		peer   string
+		header http.Header
+		want   string
+	}{
+		{peer: "1.2.3.4:5000", header: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "1.2.3.4"},
+		{peer: "127.0.0.1:5000", header: http.Header{}, want: "127.0.0.1"},
+		{peer: "127.0.0.1:5000", header: http.Header{"X-Real-Ip": {"8.8.8.8"}}, want: "8.8.8.8"},
+		{peer: "127.0.0.1:5000", header: http.Header{"X-Forwarded-For": {"6.6.6.6, 8.8.8.8, 10.1.1.1"}}, want: "8.8.8.8"},
+		{peer: "127.0.0.1:5000", header: http.Header{"X-Forwarded-For": {"6.6.6.6", "10.1.1.1"}}, want: "6.6.6.6"},
+		{peer: "127.0.0.1:5000", header: http.Header{"X-Forwarded-For": {"bad, 10.1.1.1"}}, want: "10.1.1.1"},
+	}
+
+	for _, c := range cases {
+		if got := proxies.clientIp(c.peer, c.header); got != c.want {
+			t.Fatalf("want %s, got %s with %s %v", c.want, got, c.peer, c.header)
+		}
+	}
+}
+
+func TestIpLimiter_Admit(t *testing.T) {
+	limiter, err := NewIpLimiter(IpLimitOption{MaxConns: 2, Rate: 0.001, Burst: 3, Allowlist: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if counted, err := limiter.Admit("1.1.1.1"); !counted || err != nil {
+			t.Fatalf("want admitted, got %v %v", counted, err)
+		}
+	}
+
+	if _, err = limiter.Admit("1.1.1.1"); err != ErrIpTooManyConns {
+		t.Fatalf("want %v, got %v", ErrIpTooManyConns, err)
+	}
+
+	limiter.Release("1.1.1.1")
+	if _, err = limiter.Admit("1.1.1.1"); err != ErrIpRateLimited {
+		t.Fatalf("want %v, got %v", ErrIpRateLimited, err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if counted, err := limiter.Admit("10.1.1.1"); counted || err != nil {
+			t.Fatalf("want allowlisted, got %v %v", counted, err)
+		}
+	}
+
+	if conns := limiter.Conns("1.1.1.1"); conns != 1 {
+		t.Fatalf("want 1, got %d", conns)
+	}
+
+	// 更新后令牌桶重置，已占用的名额保留
+	if err = limiter.Update(IpLimitOption{MaxConns: 2, Rate: 1, Burst: 1}); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if counted, err := limiter.Admit("1.1.1.1"); !counted || err != nil {
+		t.Fatalf("want admitted, got %v %v", counted, err)
+	}
+
+	if counted, err := limiter.Admit("10.1.1.1"); !counted || err != nil {
+		t.Fatalf("want allowlist removed, got %v %v", counted, err)
+	}
+
+	if _, err = limiter.Admit("1.1.1.1"); err != ErrIpRateLimited {
+		t.Fatalf("want %v, got %v", ErrIpRateLimited, err)
+	}
+}
+
+func TestAdmission_Check(t *testing.T) {
+	var conns int64 = 2
+	admission := NewAdmission(AdmissionOption{MaxConns: 2, MaxLag: time.Second}, func() int64 {
+		return conns
+	})
+
+	if err := admission.Check(); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	conns = 3
+	if err := admission.Check(); err != ErrServerFull {
+		t.Fatalf("want %v, got %v", ErrServerFull, err)
+	}
+
+	conns = 1
+	admission.lag.Store(time.Second * 2)
+	if err := admission.Check(); err != ErrOverloaded {
+		t.Fatalf("want %v, got %v", ErrOverloaded, err)
+	}
+
+	admission.Update(AdmissionOption{MaxConns: 1})
+	defer admission.Stop()
+	if err := admission.Check(); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	conns = 2
+	if err := admission.Check(); err != ErrServerFull {
+		t.Fatalf("want %v, got %v", ErrServerFull, err)
+	}
+}
+
+func TestAdmission_Lag(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	go loop.Run()
+	defer loop.Stop()
+
+	admission := NewAdmission(AdmissionOption{MaxLag: time.Millisecond * 100, SampleInterval: time.Millisecond * 20}, nil)
+	admission.Balance(gev.RoundRobin())([]*eventloop.EventLoop{loop})
+	admission.Start()
+	defer admission.Stop()
+
+	// 阻塞event loop，投递的任务迟迟不能执行
+	loop.QueueInLoop(func() {
+		time.Sleep(time.Millisecond * 300)
+	})
+
+	time.Sleep(time.Millisecond * 250)
+	if err = admission.Check(); err != ErrOverloaded {
+		t.Fatalf("want %v, got %v with lag %s", ErrOverloaded, err, admission.Lag())
+	}
+
+	time.Sleep(time.Millisecond * 200)
+	if err = admission.Check(); err != nil {
+		t.Fatalf("want nil after loop is idle, got %v with lag %s", err, admission.Lag())
+	}
+}
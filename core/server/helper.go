@@ -1,13 +1,20 @@
 package server
 
 import (
+	"unicode/utf8"
+
 	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
 	"go.uber.org/atomic"
 )
 
 const (
 	Id       = "ws:id"
 	Protocol = "ws:protocol"
+	Compress = "ws:compress"
+
+	// MaxCloseReason 关闭帧payload最多125字节，去掉2字节状态码
+	MaxCloseReason = 123
 )
 
 var (
@@ -29,3 +36,31 @@ func GetId(c *gev.Connection) (id uint64, exists bool) {
 
 	return value.(uint64), exists
 }
+
+// closeWithStatus 发送带状态码的关闭帧，发送后关闭写端
+func closeWithStatus(c *gev.Connection, code ws.StatusCode, reason string) {
+	setCloseReason(c, statusReason(code))
+
+	closeData, err := ws.FrameToBytes(ws.NewCloseFrame(ws.NewCloseFrameBody(code, truncateReason(reason))))
+	if err != nil {
+		_ = c.Close()
+		return
+	}
+
+	_ = c.Send(closeData, gev.SendInLoop(func(interface{}) {
+		_ = c.ShutdownWrite()
+	}))
+}
+
+// truncateReason 超过MaxCloseReason时按utf8字符边界截断
+func truncateReason(reason string) string {
+	if len(reason) <= MaxCloseReason {
+		return reason
+	}
+
+	end := MaxCloseReason
+	for end > 0 && !utf8.RuneStart(reason[end]) {
+		end--
+	}
+	return reason[:end]
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"time"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+const (
+	idleCheckInterval = time.Second
+)
+
+// WithIdleTimeout 超过timeout未收到任何帧时关闭连接，为0不检查，可以在运行时更新
+func (s *Server) WithIdleTimeout(timeout time.Duration) {
+	s.idle.Store(timeout)
+}
+
+func (s *Server) IdleTimeout() time.Duration {
+	return s.idle.Load()
+}
+
+// touch 收到数据时刷新连接的活跃时间，包括握手和控制帧
+func (s *Server) touch(c *gev.Connection) {
+	id, exists := GetId(c)
+	if !exists {
+		return
+	}
+
+	if conn, ok := s.connections.Get(id); ok {
+		if cn, yes := conn.(*Conn); yes {
+			cn.active.Store(time.Now().UnixNano())
+		}
+	}
+}
+
+// checkIdle 与gev.IdleTime相同直接关闭tcp连接，对端已失联时close帧没有意义
+func (s *Server) checkIdle() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			timeout := s.idle.Load()
+			if timeout <= 0 {
+				continue
+			}
+
+			deadline := now.Add(-timeout).UnixNano()
+			s.connections.RangeValues(func(values []interface{}) {
+				for _, conn := range values {
+					if c, ok := conn.(*Conn); ok && c.active.Load() < deadline {
+						c.Logger().Debug("close idle conn",
+							zaplogger.Event("idle"),
+						)
+						setCloseReason(c.Connection, CloseIdle)
+						_ = c.Close()
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"event/core/ratelimit"
+)
+
+const (
+	pruneInterval = time.Minute
+)
+
+var (
+	ErrIpRateLimited  = errors.New("server: ip handshake rate limited")
+	ErrIpTooManyConns = errors.New("server: too many conns from ip")
+)
+
+type IpLimitOption struct {
+	// MaxConns 单ip最大连接数，小于1不限制
+	MaxConns int `json:"maxConns"`
+	// Rate 单ip每秒握手次数，不大于0不限制
+	Rate float64 `json:"rate"`
+	// Burst 单ip握手突发次数
+	Burst int `json:"burst"`
+	// Allowlist 不受限制的ip和cidr
+	Allowlist []string `json:"allowlist"`
+}
+
+// IpLimiter 按客户端ip限制并发连接数和握手频率
+type IpLimiter struct {
+	mutex     sync.Mutex
+	opt       IpLimitOption
+	allowlist trustedProxies
+	conns     map[string]int
+	buckets   map[string]*ratelimit.Bucket
+	lastPrune time.Time
+}
+
+func NewIpLimiter(opt IpLimitOption) (limiter *IpLimiter, err error) {
+	allowlist, err := parseTrustedProxies(opt.Allowlist...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IpLimiter{
+		opt:       opt,
+		allowlist: allowlist,
+		conns:     make(map[string]int),
+		buckets:   make(map[string]*ratelimit.Bucket),
+		lastPrune: time.Now(),
+	}, nil
+}
+
+// Admit 检查握手频率和连接数，通过后占用一个连接名额，连接关闭时需要Release
+func (il *IpLimiter) Admit(ip string) (counted bool, err error) {
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+
+	if il.allowlist.contains(ip) {
+		return false, nil
+	}
+
+	now := time.Now()
+	il.prune(now)
+
+	if il.opt.Rate > 0 {
+		bucket, exists := il.buckets[ip]
+		if !exists {
+			bucket = ratelimit.NewBucket(il.opt.Rate, il.opt.Burst)
+			il.buckets[ip] = bucket
+		}
+
+		if !bucket.Allow(now) {
+			return false, ErrIpRateLimited
+		}
+	}
+
+	if il.opt.MaxConns > 0 && il.conns[ip] >= il.opt.MaxConns {
+		return false, ErrIpTooManyConns
+	}
+
+	il.conns[ip]++
+	return true, nil
+}
+
+// Update 运行时更新限制，已占用的连接名额保留，频率变化时重置令牌桶
+func (il *IpLimiter) Update(opt IpLimitOption) error {
+	allowlist, err := parseTrustedProxies(opt.Allowlist...)
+	if err != nil {
+		return err
+	}
+
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+
+	if opt.Rate != il.opt.Rate || opt.Burst != il.opt.Burst {
+		il.buckets = make(map[string]*ratelimit.Bucket)
+	}
+
+	il.opt = opt
+	il.allowlist = allowlist
+	return nil
+}
+
+func (il *IpLimiter) Release(ip string) {
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+
+	if il.conns[ip] <= 1 {
+		delete(il.conns, ip)
+		return
+	}
+	il.conns[ip]--
+}
+
+// Conns ip当前占用的连接数
+func (il *IpLimiter) Conns(ip string) int {
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+
+	return il.conns[ip]
+}
+
+// prune 回收已满的令牌桶，避免map无限增长
+func (il *IpLimiter) prune(now time.Time) {
+	if now.Sub(il.lastPrune) < pruneInterval {
+		return
+	}
+
+	il.lastPrune = now
+	for ip, bucket := range il.buckets {
+		if bucket.Full(now) {
+			delete(il.buckets, ip)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+const (
+	discardKey = "ws:discard"
+
+	// scalarSize 数字、布尔等非字符串值按8字节计算
+	scalarSize = 8
+)
+
+var (
+	ErrFrameTooLarge   = errors.New("server: frame too large")
+	ErrMessageTooLarge = errors.New("server: message too large")
+	ErrParamTooLarge   = errors.New("server: param too large")
+	ErrParamTooDeep    = errors.New("server: param too deep")
+)
+
+// MessageLimit 入站消息限制，值小于1时不限制
+type MessageLimit struct {
+	// MaxFrameSize 单帧payload长度，读取payload之前检查
+	MaxFrameSize int `json:"maxFrameSize"`
+	// MaxMessageSize 合并分帧并解压后的消息长度，Unpack之前检查
+	MaxMessageSize int `json:"maxMessageSize"`
+	// MaxParamSize 解码后param的估算大小
+	MaxParamSize int `json:"maxParamSize"`
+	// MaxDepth param嵌套深度
+	MaxDepth int `json:"maxDepth"`
+	// MaxAssembledSize 合并分片后的包长度及其param的估算大小，为0时使用MaxMessageSize和MaxParamSize，
+	// 一般与chunk.Option.MaxSize相同
+	MaxAssembledSize int `json:"maxAssembledSize"`
+}
+
+// assembled 合并分片后的包使用的限制，深度限制不变
+func (ml *MessageLimit) assembled() *MessageLimit {
+	limit := *ml
+	if limit.MaxAssembledSize > 0 {
+		limit.MaxMessageSize = limit.MaxAssembledSize
+		limit.MaxParamSize = limit.MaxAssembledSize
+	}
+	return &limit
+}
+
+func (ml *MessageLimit) checkFrame(length int64) error {
+	if ml.MaxFrameSize > 0 && length > int64(ml.MaxFrameSize) {
+		return ErrFrameTooLarge
+	}
+	return nil
+}
+
+func (ml *MessageLimit) checkMessage(length int) error {
+	if ml.MaxMessageSize > 0 && length > ml.MaxMessageSize {
+		return ErrMessageTooLarge
+	}
+	return nil
+}
+
+func (ml *MessageLimit) checkParam(param base.JsonParam) error {
+	if ml.MaxParamSize < 1 && ml.MaxDepth < 1 {
+		return nil
+	}
+
+	size := 0
+	return ml.walk(map[string]interface{}(param), 1, &size)
+}
+
+// walk depth为当前map或slice的嵌套层数，param本身为第1层
+func (ml *MessageLimit) walk(value interface{}, depth int, size *int) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ml.MaxDepth > 0 && depth > ml.MaxDepth {
+			return ErrParamTooDeep
+		}
+
+		for key, item := range v {
+			*size += len(key)
+			if err := ml.walk(item, depth+1, size); err != nil {
+				return err
+			}
+		}
+	case base.JsonParam:
+		return ml.walk(map[string]interface{}(v), depth, size)
+	case []interface{}:
+		if ml.MaxDepth > 0 && depth > ml.MaxDepth {
+			return ErrParamTooDeep
+		}
+
+		for _, item := range v {
+			if err := ml.walk(item, depth+1, size); err != nil {
+				return err
+			}
+		}
+	case string:
+		*size += len(v)
+	case []byte:
+		*size += len(v)
+	default:
+		*size += scalarSize
+	}
+
+	if ml.MaxParamSize > 0 && *size > ml.MaxParamSize {
+		return ErrParamTooLarge
+	}
+	return nil
+}
+
+// checkRaw 明文json在解码之前按与checkParam相同的规则检查param，
+// 不是json对象(加密或二进制协议)时checked为false，需要解码后再用checkParam检查
+func (ml *MessageLimit) checkRaw(data []byte) (checked bool, err error) {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 || data[0] != '{' {
+		return false, nil
+	}
+
+	if ml.MaxParamSize < 1 && ml.MaxDepth < 1 {
+		return true, nil
+	}
+
+	var (
+		// containers 当前所在的对象或数组，'{'或'['
+		containers []byte
+		// paramDepth 顶层param值所在的层数，不在param中时为0
+		paramDepth int
+		size       int
+		key        string
+		expectKey  bool
+	)
+
+	for i := 0; i < len(data); i++ {
+		switch b := data[i]; b {
+		case ' ', '\t', '\r', '\n', ':':
+		case ',':
+			expectKey = len(containers) > 0 && containers[len(containers)-1] == '{'
+		case '{', '[':
+			containers = append(containers, b)
+			expectKey = b == '{'
+			depth := len(containers)
+			if depth == 2 && strings.EqualFold(key, "param") {
+				paramDepth = depth
+			}
+
+			// param本身为第1层
+			if paramDepth > 0 && ml.MaxDepth > 0 && depth-paramDepth+1 > ml.MaxDepth {
+				return true, ErrParamTooDeep
+			}
+		case '}', ']':
+			if len(containers) == 0 {
+				return true, nil
+			}
+
+			if len(containers) == paramDepth {
+				paramDepth = 0
+			}
+			containers = containers[:len(containers)-1]
+			expectKey = false
+		case '"':
+			end, value, ok := scanString(data, i)
+			if !ok {
+				// 格式错误由Unpack返回
+				return true, nil
+			}
+
+			if expectKey && len(containers) == 1 {
+				key = value
+			}
+
+			if paramDepth > 0 {
+				size += len(value)
+			}
+			expectKey = false
+			i = end
+		default:
+			// 数字、true、false、null
+			for i+1 < len(data) && !isDelimiter(data[i+1]) {
+				i++
+			}
+
+			if paramDepth > 0 {
+				size += scalarSize
+			}
+		}
+
+		if ml.MaxParamSize > 0 && size > ml.MaxParamSize {
+			return true, ErrParamTooLarge
+		}
+	}
+	return true, nil
+}
+
+// scanString data[start]为引号，返回结束引号的位置和解码后的字符串
+func scanString(data []byte, start int) (end int, value string, ok bool) {
+	escaped := false
+	for end = start + 1; end < len(data); end++ {
+		switch data[end] {
+		case '\\':
+			escaped = true
+			end++
+		case '"':
+			if !escaped {
+				return end, string(data[start+1 : end]), true
+			}
+
+			if err := json.Unmarshal(data[start:end+1], &value); err != nil {
+				return 0, "", false
+			}
+			return end, value, true
+		}
+	}
+	return 0, "", false
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case ' ', '\t', '\r', '\n', ',', ':', '{', '}', '[', ']', '"':
+		return true
+	}
+	return false
+}
+
+// tooBig 以1009关闭连接，并丢弃之后收到的数据
+func tooBig(logger Logger, m *Metrics, c *gev.Connection, err error) {
+	withConn(logger, c).Warn("message too big",
+		zaplogger.Error(err),
+		zaplogger.Event("message"),
+	)
+
+	m.Drop(DropTooBig)
+	c.Set(discardKey, true)
+	closeWithStatus(c, ws.StatusMessageTooBig, err.Error())
+}
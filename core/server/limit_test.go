@@ -0,0 +1,115 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grpc-boot/base"
+)
+
+func TestMessageLimit_CheckParam(t *testing.T) {
+	limit := &MessageLimit{MaxParamSize: 64, MaxDepth: 3}
+
+	param := base.JsonParam{
+		"a": map[string]interface{}{
+			"b": []interface{}{1.0, "x"},
+		},
+	}
+	if err := limit.checkParam(param); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	param["a"].(map[string]interface{})["b"] = []interface{}{[]interface{}{1.0}}
+	if err := limit.checkParam(param); err != ErrParamTooDeep {
+		t.Fatalf("want %v, got %v", ErrParamTooDeep, err)
+	}
+
+	if err := limit.checkParam(base.JsonParam{"data": strings.Repeat("a", 64)}); err != ErrParamTooLarge {
+		t.Fatalf("want %v, got %v", ErrParamTooLarge, err)
+	}
+
+	if err := limit.checkFrame(65); err != nil {
+		t.Fatalf("want nil without frame limit, got %v", err)
+	}
+}
+
+func TestMessageLimit_CheckRaw(t *testing.T) {
+	limit := &MessageLimit{MaxParamSize: 64, MaxDepth: 3}
+
+	cases := []struct {
+		data string
+		want error
+	}{
+		{`{"id":1,"name":"` + strings.Repeat("n", 128) + `","param":{"a":{"b":[1,"x"]}}}`, nil},
+		{`{"id":1,"param":{"a":{"b":[[1]]}}}`, ErrParamTooDeep},
+		{`{"id":1,"param":{"data":"` + strings.Repeat("a", 64) + `"}}`, ErrParamTooLarge},
+		{`{"id":1,"Param":{"data":"` + strings.Repeat("a", 64) + `"}}`, ErrParamTooLarge},
+		{`{"id":1,"param":{"data":"a\"` + strings.Repeat("a", 48) + `"}}`, nil},
+		{`{"id":1,"param":{"list":[null,true,false,1,2,3,4,5]}}`, ErrParamTooLarge},
+	}
+
+	for index, c := range cases {
+		checked, err := limit.checkRaw([]byte(c.data))
+		if !checked || err != c.want {
+			t.Fatalf("case %d: want %v, got %v checked %v", index, c.want, err, checked)
+		}
+
+		// 与解码后的检查结果一致
+		pkg := &base.Package{}
+		if err = pkg.Unpack([]byte(c.data)); err != nil {
+			t.Fatalf("case %d: want nil, got %v", index, err)
+		}
+
+		if err = limit.checkParam(pkg.Param); err != c.want {
+			t.Fatalf("case %d: want %v after unpack, got %v", index, c.want, err)
+		}
+	}
+
+	if checked, _ := limit.checkRaw([]byte{0x01, '{'}); checked {
+		t.Fatalf("want unchecked for binary data")
+	}
+}
+
+func TestMessageLimit_Assembled(t *testing.T) {
+	limit := &MessageLimit{MaxMessageSize: 32, MaxParamSize: 16, MaxDepth: 2}
+	data := []byte(`{"id":1,"param":{"data":"` + strings.Repeat("a", 32) + `"}}`)
+
+	if got := limit.assembled(); got.checkMessage(len(data)) != ErrMessageTooLarge {
+		t.Fatalf("want %v without MaxAssembledSize, got nil", ErrMessageTooLarge)
+	}
+
+	limit.MaxAssembledSize = 128
+	assembled := limit.assembled()
+	if err := assembled.checkMessage(len(data)); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if _, err := assembled.checkRaw(data); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if _, err := assembled.checkRaw([]byte(`{"id":1,"param":{"a":{"b":{}}}}`)); err != ErrParamTooDeep {
+		t.Fatalf("want %v, got %v", ErrParamTooDeep, err)
+	}
+
+	if err := assembled.checkMessage(129); err != ErrMessageTooLarge {
+		t.Fatalf("want %v, got %v", ErrMessageTooLarge, err)
+	}
+
+	// 单条消息的限制不变
+	if limit.MaxMessageSize != 32 || limit.MaxParamSize != 16 {
+		t.Fatalf("want 32 and 16, got %d and %d", limit.MaxMessageSize, limit.MaxParamSize)
+	}
+}
+
+func TestTruncateReason(t *testing.T) {
+	if got := truncateReason("bye"); got != "bye" {
+		t.Fatalf("want bye, got %s", got)
+	}
+
+	// 3字节字符跨过长度限制时整个去掉
+	got := truncateReason(strings.Repeat("a", 122) + "中")
+	if got != strings.Repeat("a", 122) {
+		t.Fatalf("want 122 bytes, got %d", len(got))
+	}
+}
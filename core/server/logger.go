@@ -0,0 +1,101 @@
+package server
+
+import (
+	"event/core/zapkey"
+
+	"github.com/Allenxuxu/gev"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger *zap.Logger与zaplogger.Logger都满足，未设置时不输出日志
+type Logger interface {
+	Debug(msg string, fields ...zap.Field)
+	Info(msg string, fields ...zap.Field)
+	Warn(msg string, fields ...zap.Field)
+	Error(msg string, fields ...zap.Field)
+}
+
+// LevelEnabler 可选，Logger实现后连接日志在级别未开启时不构造附加字段
+type LevelEnabler interface {
+	Enabled(level zapcore.Level) bool
+}
+
+var (
+	nopLogger Logger = zap.NewNop()
+)
+
+// enabled *zap.Logger通过Core判断，zaplogger.Logger通过Is判断，其余的视为开启
+func enabled(logger Logger, level zapcore.Level) bool {
+	switch l := logger.(type) {
+	case LevelEnabler:
+		return l.Enabled(level)
+	case interface{ Core() zapcore.Core }:
+		return l.Core().Enabled(level)
+	case interface{ Is(zapcore.Level) bool }:
+		return l.Is(level)
+	}
+	return true
+}
+
+// connLogger 每条日志附加连接id、地址，握手完成后附加协议级别，绑定用户后附加用户id
+type connLogger struct {
+	logger Logger
+	c      *gev.Connection
+	conn   *Conn
+}
+
+// withConn 握手阶段还没有Conn，只附加连接上能取到的字段
+func withConn(logger Logger, c *gev.Connection) Logger {
+	if logger == nopLogger {
+		return logger
+	}
+	return connLogger{logger: logger, c: c}
+}
+
+func (cl connLogger) fields(fields []zap.Field) []zap.Field {
+	all := make([]zap.Field, 0, len(fields)+4)
+	if id, exists := GetId(cl.c); exists {
+		all = append(all, zapkey.ConnId(id))
+	}
+
+	all = append(all, zapkey.Address(remoteAddr(cl.c)))
+
+	if _, exists := cl.c.Get(Protocol); exists {
+		if req, ok := getRequest(cl.c); ok {
+			all = append(all, zapkey.ProtocolLevel(req.Level))
+		}
+	}
+
+	if cl.conn != nil {
+		if userId := cl.conn.UserId(); userId != "" {
+			all = append(all, zapkey.UserId(userId))
+		}
+	}
+
+	return append(all, fields...)
+}
+
+func (cl connLogger) Debug(msg string, fields ...zap.Field) {
+	if enabled(cl.logger, zapcore.DebugLevel) {
+		cl.logger.Debug(msg, cl.fields(fields)...)
+	}
+}
+
+func (cl connLogger) Info(msg string, fields ...zap.Field) {
+	if enabled(cl.logger, zapcore.InfoLevel) {
+		cl.logger.Info(msg, cl.fields(fields)...)
+	}
+}
+
+func (cl connLogger) Warn(msg string, fields ...zap.Field) {
+	if enabled(cl.logger, zapcore.WarnLevel) {
+		cl.logger.Warn(msg, cl.fields(fields)...)
+	}
+}
+
+func (cl connLogger) Error(msg string, fields ...zap.Field) {
+	if enabled(cl.logger, zapcore.ErrorLevel) {
+		cl.logger.Error(msg, cl.fields(fields)...)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Allenxuxu/gev"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestConn_Logger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	id, conn := newConn(&gev.Connection{}, &MessageLimit{}, zap.New(core), nil)
+
+	done := make(chan struct{})
+	go func() {
+		conn.Bind("u1")
+		conn.Join("r1", "r2")
+		conn.Leave("r2")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("want join and leave return, got deadlock")
+	}
+
+	if got := conn.Rooms(); len(got) != 1 || got[0] != "r1" {
+		t.Fatalf("want [r1], got %v", got)
+	}
+
+	entries := logs.FilterMessage("conn join").All()
+	if len(entries) != 1 {
+		t.Fatalf("want 1 join log, got %d", len(entries))
+	}
+
+	fields := entries[0].ContextMap()
+	if fields["ConnId"] != id || fields["UserId"] != "u1" {
+		t.Fatalf("want ConnId %d and UserId u1, got %v", id, fields)
+	}
+
+	// 级别未开启时不输出
+	core, logs = observer.New(zapcore.InfoLevel)
+	conn.logger = zap.New(core)
+	conn.Join("r3")
+	if logs.Len() != 0 {
+		t.Fatalf("want 0 logs, got %d", logs.Len())
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"event/core/metrics"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+)
+
+const (
+	closeReasonKey = "ws:closeReason"
+
+	HandshakeOk = "ok"
+
+	unknownEvent = "unknown"
+
+	DropRateLimited = "rate_limited"
+	DropTooBig      = "too_big"
+	DropUnpack      = "unpack_failed"
+	DropBroadcast   = "broadcast_failed"
+	DropSend        = "send_failed"
+
+	CloseClient    = "client_close"
+	ClosePeer      = "eof"
+	CloseIdle      = "idle_timeout"
+	CloseHandshake = "handshake_rejected"
+	CloseKicked    = "kicked"
+)
+
+// closeReasons 服务端主动关闭时的状态码
+var closeReasons = map[ws.StatusCode]string{
+	ws.StatusNormalClosure:       "normal",
+	ws.StatusGoingAway:           "going_away",
+	ws.StatusProtocolError:       "protocol_error",
+	ws.StatusPolicyViolation:     "policy_violation",
+	ws.StatusMessageTooBig:       "message_too_big",
+	ws.StatusInternalServerError: "internal_error",
+}
+
+// Metrics Server的prometheus指标，为nil时不统计
+type Metrics struct {
+	handshakes     *metrics.CounterVec
+	messagesIn     *metrics.CounterVec
+	messagesOut    *metrics.CounterVec
+	bytesIn        *metrics.Counter
+	bytesOut       *metrics.Counter
+	handlerLatency *metrics.HistogramVec
+	dropped        *metrics.CounterVec
+	closes         *metrics.CounterVec
+	server         *Server
+}
+
+// EventFilter Handler实现时，收到的未注册事件id在指标中统一记为unknown，避免客户端制造任意多的标签
+type EventFilter interface {
+	Handles(eventId uint16) bool
+}
+
+// newMetrics 指标名以event_ws_开头，事件id以0x0300的形式作为标签
+func newMetrics(registry *metrics.Registry, s *Server) *Metrics {
+	registry.GaugeFunc("event_ws_connections", "Active websocket connections, including those still in handshake.", func() float64 {
+		return float64(s.TotalConns())
+	})
+
+	registry.GaugeFunc("event_ws_broadcast_queue_depth", "Messages waiting in the broadcast queue.", func() float64 {
+		return float64(len(s.broadcastCh))
+	})
+
+	return &Metrics{
+		handshakes:     registry.CounterVec("event_ws_handshakes_total", "Websocket handshakes by result and requested protocol level.", "result", "level"),
+		messagesIn:     registry.CounterVec("event_ws_messages_in_total", "Packages received by event id.", "event"),
+		messagesOut:    registry.CounterVec("event_ws_messages_out_total", "Packages emitted by event id.", "event"),
+		bytesIn:        registry.Counter("event_ws_bytes_in_total", "Payload bytes of received data frames, before decompression."),
+		bytesOut:       registry.Counter("event_ws_bytes_out_total", "Payload bytes of sent data messages, before compression."),
+		handlerLatency: registry.HistogramVec("event_ws_handler_duration_seconds", "Event handler latency by event id.", metrics.DefaultBuckets, "event"),
+		dropped:        registry.CounterVec("event_ws_dropped_messages_total", "Messages dropped by reason.", "reason"),
+		closes:         registry.CounterVec("event_ws_closes_total", "Closed connections by reason.", "reason"),
+		server:         s,
+	}
+}
+
+func eventLabel(eventId uint16) string {
+	return fmt.Sprintf("0x%04x", eventId)
+}
+
+func (m *Metrics) handshake(result string, level string) {
+	if m == nil {
+		return
+	}
+	m.handshakes.With(result, level).Inc()
+}
+
+func (m *Metrics) receive(size int) {
+	if m == nil {
+		return
+	}
+	m.bytesIn.Add(float64(size))
+}
+
+func (m *Metrics) messageIn(eventId uint16) {
+	if m == nil {
+		return
+	}
+
+	label := eventLabel(eventId)
+	if filter, ok := m.server.handler.(EventFilter); ok && !filter.Handles(eventId) {
+		label = unknownEvent
+	}
+	m.messagesIn.With(label).Inc()
+}
+
+func (m *Metrics) messageOut(eventId uint16) {
+	if m == nil {
+		return
+	}
+	m.messagesOut.With(eventLabel(eventId)).Inc()
+}
+
+func (m *Metrics) send(size int) {
+	if m == nil {
+		return
+	}
+	m.bytesOut.Add(float64(size))
+}
+
+func (m *Metrics) close(reason string) {
+	if m == nil {
+		return
+	}
+	m.closes.With(reason).Inc()
+}
+
+// ObserveHandler 记录单个事件处理器的耗时
+func (m *Metrics) ObserveHandler(eventId uint16, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.handlerLatency.With(eventLabel(eventId)).Observe(duration.Seconds())
+}
+
+// Drop 记录被丢弃的消息
+func (m *Metrics) Drop(reason string) {
+	if m == nil {
+		return
+	}
+	m.dropped.With(reason).Inc()
+}
+
+// setCloseReason 只记录第一次的原因
+func setCloseReason(c *gev.Connection, reason string) {
+	if _, exists := c.Get(closeReasonKey); !exists {
+		c.Set(closeReasonKey, reason)
+	}
+}
+
+func closeReason(c *gev.Connection) string {
+	if reason, exists := c.Get(closeReasonKey); exists {
+		return reason.(string)
+	}
+	return ClosePeer
+}
+
+func statusReason(code ws.StatusCode) string {
+	if reason, exists := closeReasons[code]; exists {
+		return reason
+	}
+	return strconv.Itoa(int(code))
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+
+	"event/core/metrics"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+)
+
+type filterHandler struct{}
+
+func (filterHandler) ConnectHandle(*Conn) error                  { return nil }
+func (filterHandler) Handle(*Conn, ws.MessageType, []byte) error { return nil }
+func (filterHandler) CloseHandle(*Conn) error                    { return nil }
+func (filterHandler) Handles(eventId uint16) bool                { return eventId == 0x0300 }
+
+func TestMetrics_Labels(t *testing.T) {
+	s := NewServer()
+	defer s.close()
+
+	s.WithHandler(filterHandler{})
+	m := newMetrics(metrics.NewRegistry(), s)
+
+	m.messageIn(0x0300)
+	m.messageIn(0x1234)
+	m.messageIn(0x4321)
+
+	if got := m.messagesIn.With("0x0300").Value(); got != 1 {
+		t.Fatalf("want 1, got %v", got)
+	}
+
+	if got := m.messagesIn.With(unknownEvent).Value(); got != 2 {
+		t.Fatalf("want 2, got %v", got)
+	}
+
+	c := &gev.Connection{}
+	for value, want := range map[string]string{"": "0", "07": "7", "+2": "2", "8": "invalid", "x": "invalid"} {
+		c.Set(Request, &HandshakeRequest{Query: url.Values{"l": {value}}})
+		if got := requestLevel(c); got != want {
+			t.Fatalf("want %s for %q, got %s", want, value, got)
+		}
+	}
+}
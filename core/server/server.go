@@ -4,21 +4,25 @@ import (
 	"context"
 	"errors"
 	"runtime"
+	"sync"
 	"time"
 
 	"event/core/conngroup"
+	"event/core/metrics"
+	"event/core/tracing"
 
 	"github.com/Allenxuxu/gev"
-	"github.com/Allenxuxu/gev/plugins/websocket"
 	"github.com/Allenxuxu/gev/plugins/websocket/ws"
 	"github.com/Allenxuxu/gev/plugins/websocket/ws/util"
 	"github.com/grpc-boot/base"
 	"github.com/grpc-boot/base/core/zaplogger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/atomic"
 )
 
 type Handler interface {
 	ConnectHandle(conn *Conn) error
-	Handle(conn *Conn, data []byte) error
+	Handle(conn *Conn, messageType ws.MessageType, data []byte) error
 	CloseHandle(conn *Conn) error
 }
 
@@ -28,29 +32,126 @@ type Server struct {
 	broadcastCh     chan *base.Package
 	shutdownHandler func(s *Server) error
 	handler         Handler
+	handshake       *Handshake
+	limit           MessageLimit
+	tls             *tlsTerminator
+	idle            atomic.Duration
+	done            chan struct{}
+	doneOnce        sync.Once
+	logger          Logger
+	admission       *Admission
+	metrics         *Metrics
+	tracer          *tracing.Tracer
 }
 
+// Option 创建独立Server的参数，零值字段使用默认值
+type Option struct {
+	Addr string
+	// NumLoops event loop数量，默认runtime.NumCPU()
+	NumLoops  int
+	ReusePort bool
+	// Handshake 握手校验与协议协商，必填
+	Handshake *Handshake
+	Handler   Handler
+	// Logger 默认不输出日志
+	Logger Logger
+	// Compression 为nil时不协商permessage-deflate
+	Compression *Compression
+	Limit       MessageLimit
+	// IdleTimeout 超过该时间未收到数据时关闭连接，为0不检查
+	IdleTimeout time.Duration
+	// Admission 连接数与负载上限，零值不限制
+	Admission AdmissionOption
+	TLS       TLSOption
+	// Metrics 为nil时不统计指标
+	Metrics *metrics.Registry
+	// Tracer 为nil时不创建span
+	Tracer *tracing.Tracer
+}
+
+var (
+	ErrNoHandler   = errors.New("server: handler is nil")
+	ErrNoHandshake = errors.New("server: handshake is nil")
+)
+
 func NewServer() *Server {
 	server := &Server{
 		connections: conngroup.NewConnGroup(),
 		broadcastCh: make(chan *base.Package, 1024),
+		done:        make(chan struct{}),
+		logger:      nopLogger,
 	}
 
 	go server.broadcast()
 	return server
 }
 
+// New 创建不依赖全局配置的Server，返回时已开始监听，Start之后开始处理连接
+func New(opt Option) (*Server, error) {
+	if opt.Handler == nil {
+		return nil, ErrNoHandler
+	}
+
+	if opt.Handshake == nil {
+		return nil, ErrNoHandshake
+	}
+
+	s := NewServer()
+	if opt.Logger != nil {
+		s.WithLogger(opt.Logger)
+	}
+
+	if opt.Metrics != nil {
+		s.WithMetrics(opt.Metrics)
+	}
+	s.WithTracer(opt.Tracer)
+
+	s.admission = NewAdmission(opt.Admission, s.TotalConns)
+	opt.Handshake.WithAdmission(s.admission)
+
+	s.WithHandler(opt.Handler)
+	s.WithHandshake(opt.Handshake)
+	s.WithMessageLimit(opt.Limit)
+	s.WithIdleTimeout(opt.IdleTimeout)
+
+	if err := s.WithTLS(opt.TLS); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	upgrader := &ws.Upgrader{}
+	if opt.Compression != nil {
+		upgrader.ExtensionCustom = opt.Compression.Negotiate
+	}
+
+	gevOpts := []gev.Option{gev.Address(opt.Addr), gev.ReusePort(opt.ReusePort)}
+	if opt.NumLoops > 0 {
+		gevOpts = append(gevOpts, gev.NumLoops(opt.NumLoops))
+	}
+
+	if err := s.listen(upgrader, gevOpts...); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
 func (s *Server) broadcast() {
 	for {
-		msg, ok := <-s.broadcastCh
-		if !ok {
-			break
+		var msg *base.Package
+		select {
+		case <-s.done:
+			return
+		case msg = <-s.broadcastCh:
 		}
 
+		span, traced := traceBroadcast(s.tracer, msg, s.TotalConns())
+		failed := 0
+
 		s.connections.RangeValues(func(values []interface{}) {
 			defer func() {
 				if er := recover(); er != nil {
-					base.ZapError("broadcast failed",
+					s.logger.Error("broadcast failed",
 						zaplogger.Error(er.(error)),
 						zaplogger.Event("broadcast"),
 					)
@@ -59,10 +160,18 @@ func (s *Server) broadcast() {
 
 			for _, conn := range values {
 				if c, ok := conn.(*Conn); ok && c.Connection != nil {
-					_ = c.Emit(msg)
+					if err := c.emit(msg); err != nil {
+						s.metrics.Drop(DropBroadcast)
+						failed++
+					}
 				}
 			}
 		})
+
+		if traced {
+			span.SetAttributes(attribute.Int("broadcast.failed", failed))
+			span.End()
+		}
 	}
 }
 
@@ -70,7 +179,7 @@ func (s *Server) Broadcast(msg *base.Package) {
 	s.broadcastCh <- msg
 }
 
-func (s *Server) OnMessage(c *gev.Connection, data []byte) (messageType ws.MessageType, out []byte) {
+func (s *Server) OnMessage(c *gev.Connection, messageType ws.MessageType, data []byte) (outType ws.MessageType, out []byte) {
 	id, exists := GetId(c)
 	if !exists {
 		if closeData, err := util.PackCloseData("not found id"); err == nil {
@@ -96,8 +205,8 @@ func (s *Server) OnMessage(c *gev.Connection, data []byte) (messageType ws.Messa
 		cn.first = false
 	}
 
-	if err := s.handler.Handle(cn, data); err != nil {
-		base.ZapError("handler message failed",
+	if err := s.handler.Handle(cn, messageType, data); err != nil {
+		cn.Logger().Error("handler message failed",
 			zaplogger.Error(err),
 			zaplogger.Event("message"),
 		)
@@ -106,7 +215,8 @@ func (s *Server) OnMessage(c *gev.Connection, data []byte) (messageType ws.Messa
 }
 
 func (s *Server) OnConnect(c *gev.Connection) {
-	id, conn := newConn(c)
+	id, conn := newConn(c, &s.limit, s.logger, s.metrics)
+	conn.tracer = s.tracer
 
 	if err := s.handler.ConnectHandle(conn); err != nil {
 		_ = conn.SendClose("connect failed")
@@ -117,9 +227,15 @@ func (s *Server) OnConnect(c *gev.Connection) {
 }
 
 func (s *Server) OnClose(c *gev.Connection) {
+	s.metrics.close(closeReason(c))
+
+	if s.handshake != nil {
+		s.handshake.release(c)
+	}
+
 	id, exists := GetId(c)
 	if !exists {
-		base.ZapError("conn not found id",
+		s.logger.Error("conn not found id",
 			zaplogger.Event("close"),
 		)
 		return
@@ -134,10 +250,72 @@ func (s *Server) OnClose(c *gev.Connection) {
 	s.connections.Delete(id)
 }
 
+// WithLogger 需要在Serve之前设置
+func (s *Server) WithLogger(logger Logger) {
+	s.logger = logger
+}
+
+func (s *Server) Logger() Logger {
+	return s.logger
+}
+
+// WithMetrics 在registry中注册Server的指标，需要在Serve之前设置，每个registry只能设置一次
+func (s *Server) WithMetrics(registry *metrics.Registry) {
+	s.metrics = newMetrics(registry, s)
+}
+
+// Metrics 未开启时为nil
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
+}
+
+// WithTracer 需要在Serve之前设置
+func (s *Server) WithTracer(tracer *tracing.Tracer) {
+	s.tracer = tracer
+}
+
+// Tracer 未开启时为nil
+func (s *Server) Tracer() *tracing.Tracer {
+	return s.tracer
+}
+
+// Admission New创建时才有
+func (s *Server) Admission() *Admission {
+	return s.admission
+}
+
 func (s *Server) WithHandler(handler Handler) {
 	s.handler = handler
 }
 
+// WithHandshake Serve时绑定到upgrader，连接关闭时归还ip连接名额
+func (s *Server) WithHandshake(handshake *Handshake) {
+	s.handshake = handshake
+}
+
+// WithMessageLimit 入站消息限制，超过时以1009关闭连接，需要在Serve之前设置
+func (s *Server) WithMessageLimit(limit MessageLimit) {
+	s.limit = limit
+}
+
+// WithTLS 开启tls，Serve时gev改为监听opt.BackendAddr
+func (s *Server) WithTLS(opt TLSOption) (err error) {
+	if !opt.Enable {
+		return nil
+	}
+
+	s.tls, err = newTLSTerminator(opt)
+	return err
+}
+
+// ReloadCertificate 立即重新加载tls证书
+func (s *Server) ReloadCertificate() error {
+	if s.tls == nil {
+		return nil
+	}
+	return s.tls.reloader.Reload()
+}
+
 func (s *Server) WithShutdown(handler func(s *Server) error) {
 	s.shutdownHandler = handler
 }
@@ -148,7 +326,10 @@ func (s *Server) Shutdown(timeout time.Duration) (err error) {
 
 	done := make(chan struct{}, 1)
 	go func() {
-		s.server.Stop()
+		s.close()
+		if s.server != nil {
+			s.server.Stop()
+		}
 		if s.shutdownHandler != nil {
 			err = s.shutdownHandler(s)
 		}
@@ -167,22 +348,80 @@ func (s *Server) TotalConns() int64 {
 	return s.connections.Length()
 }
 
+// close 停止后台任务，gev server由调用方停止
+func (s *Server) close() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+
+		if s.admission != nil {
+			s.admission.Stop()
+		}
+
+		if s.tls != nil {
+			_ = s.tls.close()
+		}
+	})
+}
+
 func (s *Server) Serve(upgrader *ws.Upgrader, opts ...gev.Option) error {
+	if err := s.listen(upgrader, opts...); err != nil {
+		return err
+	}
+
+	s.Start()
+	return nil
+}
+
+// Start 阻塞直到Shutdown
+func (s *Server) Start() {
+	if s.admission != nil {
+		s.admission.Start()
+	}
+
+	go s.checkIdle()
+
+	s.server.Start()
+}
+
+// listen 创建gev server并监听，开启tls时同时监听tls端口
+func (s *Server) listen(upgrader *ws.Upgrader, opts ...gev.Option) error {
+	if s.handshake != nil {
+		s.handshake.logger = s.logger
+		s.handshake.metrics = s.metrics
+		s.handshake.tracer = s.tracer
+		s.handshake.Bind(upgrader)
+	}
+
+	if s.tls != nil {
+		opts = append(opts, gev.Address(s.tls.opt.BackendAddr))
+		s.tls.logger = s.logger
+		if s.handshake != nil {
+			s.handshake.peer = s.tls.peer
+		}
+	}
+
 	defaultOpts := []gev.Option{
 		gev.Network("tcp"),
 		gev.NumLoops(runtime.NumCPU()),
-		gev.CustomProtocol(websocket.New(upgrader)),
+		gev.CustomProtocol(newWsProtocol(upgrader, &s.limit, s.logger, s.metrics)),
 	}
 
 	opts = append(defaultOpts, opts...)
+	if s.admission != nil {
+		opts = append(opts, gev.LoadBalance(s.admission.Balance(gev.RoundRobin())))
+	}
 
-	ser, err := gev.NewServer(websocket.NewHandlerWrap(upgrader, s), opts...)
+	ser, err := gev.NewServer(newHandlerWrap(s), opts...)
 	if err != nil {
 		return err
 	}
 
 	s.server = ser
 
-	s.server.Start()
+	if s.tls != nil {
+		if err = s.tls.listen(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
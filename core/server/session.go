@@ -0,0 +1,188 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"event/core/zapkey"
+
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/grpc-boot/base"
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+// session 连接绑定的用户和加入的房间，用户默认为握手时Authorizer设置的UserId，
+// 之后由事件处理器调用Bind、Join和Leave维护，没有处理器调用时按用户或房间查找不到连接
+type session struct {
+	mutex  sync.RWMutex
+	bound  bool
+	userId string
+	rooms  map[string]struct{}
+}
+
+// Bind 绑定用户，覆盖握手时的UserId，一个用户可以有多个连接，为空时解除绑定
+func (c *Conn) Bind(userId string) {
+	c.session.mutex.Lock()
+	c.session.bound = true
+	c.session.userId = userId
+	c.session.mutex.Unlock()
+
+	c.Logger().Debug("conn bind",
+		zaplogger.Event("bind"),
+	)
+}
+
+func (c *Conn) UserId() string {
+	c.session.mutex.RLock()
+	bound, userId := c.session.bound, c.session.userId
+	c.session.mutex.RUnlock()
+
+	if !bound {
+		return c.request().UserId
+	}
+	return userId
+}
+
+// Join 日志在解锁之后输出，连接日志会读取UserId
+func (c *Conn) Join(rooms ...string) {
+	c.session.mutex.Lock()
+	if c.session.rooms == nil {
+		c.session.rooms = make(map[string]struct{}, len(rooms))
+	}
+
+	for _, room := range rooms {
+		c.session.rooms[room] = struct{}{}
+	}
+	c.session.mutex.Unlock()
+
+	c.Logger().Debug("conn join",
+		zapkey.Rooms(rooms),
+		zaplogger.Event("join"),
+	)
+}
+
+func (c *Conn) Leave(rooms ...string) {
+	c.session.mutex.Lock()
+	for _, room := range rooms {
+		delete(c.session.rooms, room)
+	}
+	c.session.mutex.Unlock()
+
+	c.Logger().Debug("conn leave",
+		zapkey.Rooms(rooms),
+		zaplogger.Event("leave"),
+	)
+}
+
+func (c *Conn) InRoom(room string) bool {
+	c.session.mutex.RLock()
+	defer c.session.mutex.RUnlock()
+
+	_, exists := c.session.rooms[room]
+	return exists
+}
+
+// Rooms 已加入的房间，按名称排序
+func (c *Conn) Rooms() []string {
+	c.session.mutex.RLock()
+	rooms := make([]string, 0, len(c.session.rooms))
+	for room := range c.session.rooms {
+		rooms = append(rooms, room)
+	}
+	c.session.mutex.RUnlock()
+
+	sort.Strings(rooms)
+	return rooms
+}
+
+// Created 连接建立的时间
+func (c *Conn) Created() time.Time {
+	return c.created
+}
+
+// Active 最后收到数据的时间
+func (c *Conn) Active() time.Time {
+	return time.Unix(0, c.active.Load())
+}
+
+// Kick 以1008关闭连接，reason会发给客户端
+func (c *Conn) Kick(reason string) {
+	setCloseReason(c.Connection, CloseKicked)
+	c.Logger().Info("conn kicked",
+		zapkey.Reason(reason),
+		zaplogger.Event("kick"),
+	)
+	closeWithStatus(c.Connection, ws.StatusPolicyViolation, reason)
+}
+
+// Conn 按id查找已握手的连接
+func (s *Server) Conn(id uint64) (conn *Conn, exists bool) {
+	value, exists := s.connections.Get(id)
+	if !exists {
+		return nil, false
+	}
+
+	conn, exists = value.(*Conn)
+	return conn, exists
+}
+
+// Range 遍历全部连接，fn返回false时停止
+func (s *Server) Range(fn func(conn *Conn) bool) {
+	stopped := false
+	s.connections.RangeValues(func(values []interface{}) {
+		for _, value := range values {
+			if stopped {
+				return
+			}
+
+			if conn, ok := value.(*Conn); ok && conn.Connection != nil {
+				stopped = !fn(conn)
+			}
+		}
+	})
+}
+
+// Filter 返回filter为true的连接，需要遍历全部连接
+func (s *Server) Filter(filter func(conn *Conn) bool) (conns []*Conn) {
+	s.Range(func(conn *Conn) bool {
+		if filter(conn) {
+			conns = append(conns, conn)
+		}
+		return true
+	})
+	return
+}
+
+func (s *Server) UserConns(userId string) []*Conn {
+	return s.Filter(func(conn *Conn) bool {
+		return conn.UserId() == userId
+	})
+}
+
+func (s *Server) RoomConns(room string) []*Conn {
+	return s.Filter(func(conn *Conn) bool {
+		return conn.InRoom(room)
+	})
+}
+
+// SendTo 发送给conns，返回发送成功的数量
+func (s *Server) SendTo(conns []*Conn, pkg *base.Package) (sent int) {
+	for _, conn := range conns {
+		if err := conn.Emit(pkg); err != nil {
+			s.metrics.Drop(DropSend)
+			continue
+		}
+		sent++
+	}
+	return
+}
+
+// KickUser 关闭用户的全部连接，返回关闭的数量
+func (s *Server) KickUser(userId string, reason string) int {
+	conns := s.UserConns(userId)
+	for _, conn := range conns {
+		conn.Kick(reason)
+	}
+	return len(conns)
+}
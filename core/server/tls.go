@@ -0,0 +1,331 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"event/core/zapkey"
+
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+const (
+	defaultBackendAddr    = "127.0.0.1:3334"
+	defaultReloadInterval = time.Second * 10
+	tlsHandshakeTimeout   = time.Second * 10
+	backendDialTimeout    = time.Second * 5
+	closeWaitTimeout      = time.Second * 5
+)
+
+var (
+	ErrClientCaRequired = errors.New("server: client ca is required for client auth")
+	ErrClientCaEmpty    = errors.New("server: no certificates in client ca")
+	ErrBackendNotLocal  = errors.New("server: tls backend must listen on a loopback address")
+)
+
+// TLSOption gev不支持tls，开启后在Addr上终止tls，再转发到只监听回环地址的gev
+type TLSOption struct {
+	Enable bool `json:"enable"`
+	// Addr tls监听地址
+	Addr string `json:"addr"`
+	// BackendAddr gev监听的回环地址，必须是127.0.0.1、::1或localhost，不接受未经tls转发的连接
+	BackendAddr string `json:"backendAddr"`
+	CertFile    string `json:"certFile"`
+	KeyFile     string `json:"keyFile"`
+	// ClientCaFile 校验客户端证书的ca
+	ClientCaFile string `json:"clientCaFile"`
+	// ClientAuth none、request(提供时校验)、require(必须提供并校验)
+	ClientAuth string `json:"clientAuth"`
+	// ReloadInterval 检查证书文件变化的间隔
+	ReloadInterval time.Duration `json:"reloadInterval"`
+}
+
+func (opt *TLSOption) init() {
+	if opt.BackendAddr == "" {
+		opt.BackendAddr = defaultBackendAddr
+	}
+
+	if opt.ClientAuth == "" {
+		opt.ClientAuth = ClientAuthNone
+	}
+
+	if opt.ReloadInterval <= 0 {
+		opt.ReloadInterval = defaultReloadInterval
+	}
+}
+
+// certReloader 证书、私钥和客户端ca文件修改后重新加载
+type certReloader struct {
+	mutex    sync.RWMutex
+	opt      TLSOption
+	cert     *tls.Certificate
+	clientCa *x509.CertPool
+	modTime  time.Time
+}
+
+func newCertReloader(opt TLSOption) (cr *certReloader, err error) {
+	cr = &certReloader{opt: opt}
+	if err = cr.Reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// Reload 重新加载证书，失败时保留原证书
+func (cr *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.opt.CertFile, cr.opt.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCa *x509.CertPool
+	if cr.opt.ClientCaFile != "" {
+		pem, err := ioutil.ReadFile(cr.opt.ClientCaFile)
+		if err != nil {
+			return err
+		}
+
+		clientCa = x509.NewCertPool()
+		if !clientCa.AppendCertsFromPEM(pem) {
+			return ErrClientCaEmpty
+		}
+	} else if cr.opt.ClientAuth != ClientAuthNone {
+		return ErrClientCaRequired
+	}
+
+	cr.mutex.Lock()
+	cr.cert = &cert
+	cr.clientCa = clientCa
+	cr.modTime = cr.latestModTime()
+	cr.mutex.Unlock()
+	return nil
+}
+
+func (cr *certReloader) latestModTime() (latest time.Time) {
+	for _, file := range []string{cr.opt.CertFile, cr.opt.KeyFile, cr.opt.ClientCaFile} {
+		if file == "" {
+			continue
+		}
+
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return
+}
+
+func (cr *certReloader) changed() bool {
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	return cr.latestModTime().After(cr.modTime)
+}
+
+func (cr *certReloader) watch(done chan struct{}, logger Logger) {
+	ticker := time.NewTicker(cr.opt.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !cr.changed() {
+				continue
+			}
+
+			if err := cr.Reload(); err != nil {
+				logger.Error("reload certificate failed",
+					zaplogger.Error(err),
+					zaplogger.Event("tls"),
+				)
+				continue
+			}
+
+			logger.Info("certificate reloaded",
+				zaplogger.Event("tls"),
+			)
+		}
+	}
+}
+
+// config 每次握手都按当前的证书和ca生成配置
+func (cr *certReloader) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*cr.cert},
+		ClientCAs:    cr.clientCa,
+	}
+
+	switch cr.opt.ClientAuth {
+	case ClientAuthRequest:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// tlsTerminator 终止tls并把明文转发给gev，记录回环连接与客户端地址的对应关系
+type tlsTerminator struct {
+	opt      TLSOption
+	reloader *certReloader
+	listener net.Listener
+	peers    sync.Map
+	done     chan struct{}
+	stopOnce sync.Once
+	logger   Logger
+}
+
+func newTLSTerminator(opt TLSOption) (t *tlsTerminator, err error) {
+	opt.init()
+
+	if !isLoopback(opt.BackendAddr) {
+		return nil, ErrBackendNotLocal
+	}
+
+	reloader, err := newCertReloader(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsTerminator{
+		opt:      opt,
+		reloader: reloader,
+		done:     make(chan struct{}),
+		logger:   nopLogger,
+	}, nil
+}
+
+func (t *tlsTerminator) listen() (err error) {
+	t.listener, err = tls.Listen("tcp", t.opt.Addr, &tls.Config{
+		GetConfigForClient: t.reloader.config,
+	})
+	if err != nil {
+		return err
+	}
+
+	go t.reloader.watch(t.done, t.logger)
+	go t.serve()
+	return nil
+}
+
+func (t *tlsTerminator) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+
+			t.logger.Error("accept tls conn failed",
+				zaplogger.Error(err),
+				zaplogger.Event("tls"),
+			)
+			time.Sleep(time.Millisecond * 10)
+			continue
+		}
+
+		go t.handle(conn.(*tls.Conn))
+	}
+}
+
+func (t *tlsTerminator) handle(conn *tls.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		t.logger.Debug("tls handshake failed",
+			zaplogger.Error(err),
+			zapkey.Address(conn.RemoteAddr().String()),
+			zaplogger.Event("tls"),
+		)
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	backend, err := net.DialTimeout("tcp", t.opt.BackendAddr, backendDialTimeout)
+	if err != nil {
+		t.logger.Error("dial backend failed",
+			zaplogger.Error(err),
+			zaplogger.Event("tls"),
+		)
+		return
+	}
+	defer backend.Close()
+
+	// 先记录地址再转发数据，保证gev握手时能查到客户端地址
+	key := backend.LocalAddr().String()
+	t.peers.Store(key, conn.RemoteAddr().String())
+	defer t.peers.Delete(key)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(backend, conn)
+		_ = backend.(*net.TCPConn).CloseWrite()
+		done <- struct{}{}
+	}()
+
+	go func() {
+		_, _ = io.Copy(conn, backend)
+		_ = conn.CloseWrite()
+		// gev已关闭，客户端迟迟不关闭时不再等待
+		_ = conn.SetReadDeadline(time.Now().Add(closeWaitTimeout))
+		done <- struct{}{}
+	}()
+
+	<-done
+	<-done
+}
+
+// peer 回环连接对应的客户端地址，不是经过tls转发的连接ok为false
+func (t *tlsTerminator) peer(addr string) (client string, ok bool) {
+	if value, exists := t.peers.Load(addr); exists {
+		return value.(string), true
+	}
+	return addr, false
+}
+
+// isLoopback host为空时监听全部地址，不是回环地址
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (t *tlsTerminator) close() error {
+	var err error
+	t.stopOnce.Do(func() {
+		close(t.done)
+		if t.listener != nil {
+			err = t.listener.Close()
+		}
+	})
+	return err
+}
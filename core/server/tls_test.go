@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Allenxuxu/gev"
+)
+
+func writeCert(t *testing.T, dir, name string, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	_ = ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestTLSTerminator(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, caKey := writeCert(t, dir, "ca", 1, nil, nil)
+	writeCert(t, dir, "server", 2, ca, caKey)
+	writeCert(t, dir, "client", 3, ca, caKey)
+
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	defer backend.Close()
+
+	peers := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+
+			peers <- conn.RemoteAddr().String()
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	terminator, err := newTLSTerminator(TLSOption{
+		Enable:       true,
+		Addr:         "127.0.0.1:0",
+		BackendAddr:  backend.Addr().String(),
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCaFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   ClientAuthRequire,
+	})
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if err = terminator.listen(); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	defer terminator.close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, _ := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+
+	dial := func(certs []tls.Certificate) (serial int64, err error) {
+		conn, err := tls.Dial("tcp", terminator.listener.Addr().String(), &tls.Config{RootCAs: roots, Certificates: certs})
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+
+		if _, err = conn.Write([]byte("hello\n")); err != nil {
+			return 0, err
+		}
+
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+
+		if line != "hello\n" {
+			t.Fatalf("want hello, got %s", line)
+		}
+
+		if peer, ok := terminator.peer(<-peers); !ok || peer != conn.LocalAddr().String() {
+			t.Fatalf("want %s, got %s", conn.LocalAddr().String(), peer)
+		}
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+	}
+
+	if _, err = dial(nil); err == nil {
+		t.Fatalf("want client certificate required, got nil")
+	}
+
+	serial, err := dial([]tls.Certificate{clientCert})
+	if err != nil || serial != 2 {
+		t.Fatalf("want serial 2, got %d %v", serial, err)
+	}
+
+	writeCert(t, dir, "server", 4, ca, caKey)
+	if err = terminator.reloader.Reload(); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if serial, err = dial([]tls.Certificate{clientCert}); err != nil || serial != 4 {
+		t.Fatalf("want serial 4 after reload, got %d %v", serial, err)
+	}
+}
+
+func TestTLSTerminator_Backend(t *testing.T) {
+	for addr, want := range map[string]error{
+		":3334":          ErrBackendNotLocal,
+		"0.0.0.0:3334":   ErrBackendNotLocal,
+		"10.0.0.1:3334":  ErrBackendNotLocal,
+		"127.0.0.1:3334": nil,
+		"[::1]:3334":     nil,
+		"localhost:3334": nil,
+	} {
+		if got := isLoopback(addr); got != (want == nil) {
+			t.Fatalf("want %v, got %v with %s", want == nil, got, addr)
+		}
+	}
+
+	if _, err := newTLSTerminator(TLSOption{Enable: true, BackendAddr: ":3334"}); err != ErrBackendNotLocal {
+		t.Fatalf("want ErrBackendNotLocal, got %v", err)
+	}
+
+	// 未经tls转发直连后端的连接被拒绝
+	h := NewHandshake(nil)
+	h.peer = func(addr string) (string, bool) {
+		return addr, false
+	}
+
+	c := &gev.Connection{}
+	c.Set(Request, &HandshakeRequest{Header: http.Header{"X-Forwarded-For": {"1.2.3.4"}}})
+	if _, err := h.OnBeforeUpgrade(c); err == nil {
+		t.Fatalf("want rejected, got nil")
+	}
+
+	if got := h.Rejections()[ReasonTLSRequired]; got != 1 {
+		t.Fatalf("want 1 rejection, got %d", got)
+	}
+}
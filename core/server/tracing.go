@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"event/core/tracing"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/grpc-boot/base"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	handshakeStartKey = "ws:handshakeStart"
+)
+
+// EventAttr span中的事件id，与指标标签相同为0x0300的形式
+func EventAttr(eventId uint16) attribute.KeyValue {
+	return attribute.String("event.id", fmt.Sprintf("0x%04x", eventId))
+}
+
+// ConnAttr span中的连接id
+func ConnAttr(c *gev.Connection) attribute.KeyValue {
+	id, _ := GetId(c)
+	return attribute.Int64("conn.id", int64(id))
+}
+
+// traceHandshake 握手结束时创建span，开始时间为收到请求时，上游trace context取自traceparent header
+func traceHandshake(tracer *tracing.Tracer, c *gev.Connection, result string, err error) {
+	if !tracer.Enabled() {
+		return
+	}
+
+	var (
+		ctx   = context.Background()
+		start time.Time
+		attrs = []attribute.KeyValue{
+			attribute.String("ws.result", result),
+			attribute.String("ws.level", requestLevel(c)),
+		}
+	)
+
+	if value, exists := c.Get(handshakeStartKey); exists {
+		start = value.(time.Time)
+	}
+
+	if req, exists := getRequest(c); exists {
+		ctx = tracing.ExtractHeader(ctx, req.Header)
+		attrs = append(attrs, attribute.String("net.peer.ip", req.ClientIp))
+	}
+
+	_, span := tracer.Start(ctx, "ws.handshake", start, trace.SpanKindServer, attrs...)
+	tracing.End(span, err)
+}
+
+// traceEmit 只为带trace context的包创建span
+func traceEmit(c *Conn, pkg *base.Package) (trace.Span, bool) {
+	if !c.tracer.Enabled() {
+		return nil, false
+	}
+
+	ctx := tracing.Extract(context.Background(), pkg.Param)
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil, false
+	}
+
+	_, span := c.tracer.Start(ctx, "event.emit", time.Time{}, trace.SpanKindProducer, EventAttr(pkg.Id), ConnAttr(c.Connection))
+	return span, true
+}
+
+// traceBroadcast 广播span的trace context写入msg，客户端可以据此关联，单个连接的发送不再创建span
+func traceBroadcast(tracer *tracing.Tracer, msg *base.Package, conns int64) (trace.Span, bool) {
+	if !tracer.Enabled() {
+		return nil, false
+	}
+
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), msg.Param), "event.broadcast", time.Time{}, trace.SpanKindProducer,
+		EventAttr(msg.Id),
+		attribute.Int64("broadcast.conns", conns),
+	)
+	msg.Param = tracing.Inject(ctx, msg.Param)
+	return span, true
+}
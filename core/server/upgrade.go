@@ -0,0 +1,90 @@
+package server
+
+import (
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/Allenxuxu/ringbuffer"
+	"github.com/gobwas/pool/pbytes"
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+const (
+	upgradedKey = "gev_ws_upgraded"
+)
+
+// wsProtocol 与websocket.Protocol相同，但握手被拒绝时会把错误响应发给客户端并关闭写端
+type wsProtocol struct {
+	upgrader *ws.Upgrader
+	limit    *MessageLimit
+	logger   Logger
+	metrics  *Metrics
+}
+
+func newWsProtocol(upgrader *ws.Upgrader, limit *MessageLimit, logger Logger, metrics *Metrics) *wsProtocol {
+	return &wsProtocol{upgrader: upgrader, limit: limit, logger: logger, metrics: metrics}
+}
+
+func (p *wsProtocol) UnPacket(c *gev.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	if _, discard := c.Get(discardKey); discard {
+		buffer.RetrieveAll()
+		return
+	}
+
+	if _, ok := c.Get(upgradedKey); !ok {
+		var err error
+		out, _, err = p.upgrader.Upgrade(c, buffer)
+		if err != nil {
+			// 请求不完整时out为空，等待后续数据
+			if len(out) > 0 {
+				_ = c.Send(out, gev.SendInLoop(func(interface{}) {
+					_ = c.ShutdownWrite()
+				}))
+			}
+			return nil, nil
+		}
+
+		c.Set(upgradedKey, true)
+		c.Set(headerBufferKey, pbytes.Get(0, ws.MaxHeaderSize-2))
+		return
+	}
+
+	bts, _ := c.Get(headerBufferKey)
+	header, err := ws.VirtualReadHeader(bts.([]byte), buffer)
+	if err != nil {
+		if err != ws.ErrHeaderNotReady {
+			p.logger.Error("read frame header failed",
+				zaplogger.Error(err),
+				zaplogger.Event("message"),
+			)
+		}
+		return
+	}
+
+	// 在payload进入内存之前拒绝过大的帧
+	if err = p.limit.checkFrame(header.Length); err != nil {
+		buffer.VirtualRevert()
+		buffer.RetrieveAll()
+		tooBig(p.logger, p.metrics, c, err)
+		return
+	}
+
+	if buffer.VirtualLength() < int(header.Length) {
+		buffer.VirtualRevert()
+		return
+	}
+
+	buffer.VirtualFlush()
+
+	payload := make([]byte, int(header.Length))
+	_, _ = buffer.Read(payload)
+
+	if header.Masked {
+		ws.Cipher(payload, header.Mask, 0)
+	}
+
+	return &header, payload
+}
+
+func (p *wsProtocol) Packet(c *gev.Connection, data interface{}) []byte {
+	return data.([]byte)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"event/core/zapkey"
+
+	"github.com/Allenxuxu/gev"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/Allenxuxu/gev/plugins/websocket/ws/util"
+	"github.com/gobwas/pool/pbytes"
+	"github.com/grpc-boot/base/core/zaplogger"
+)
+
+const (
+	headerBufferKey = "gev_header_buf"
+	fragmentKey     = "ws:fragment"
+)
+
+// fragment 分帧消息，收到fin帧之前暂存
+type fragment struct {
+	opCode     ws.OpCode
+	compressed bool
+	data       []byte
+}
+
+// handlerWrap 与websocket.HandlerWrap相同，但会把帧类型传给Server
+type handlerWrap struct {
+	server *Server
+}
+
+func newHandlerWrap(s *Server) *handlerWrap {
+	return &handlerWrap{server: s}
+}
+
+func (hw *handlerWrap) OnConnect(c *gev.Connection) {
+	hw.server.OnConnect(c)
+}
+
+func (hw *handlerWrap) OnMessage(c *gev.Connection, ctx interface{}, payload []byte) interface{} {
+	hw.server.touch(c)
+
+	header, ok := ctx.(*ws.Header)
+	if !ok {
+		// 握手响应
+		if len(payload) != 0 {
+			return payload
+		}
+		return nil
+	}
+
+	if header.OpCode.IsControl() {
+		var (
+			out []byte
+			err error
+		)
+
+		switch header.OpCode {
+		case ws.OpClose:
+			setCloseReason(c, CloseClient)
+			out, err = util.HandleClose(header, payload)
+			_ = c.ShutdownWrite()
+		case ws.OpPing:
+			out, err = util.HandlePing(payload)
+		case ws.OpPong:
+			out, err = util.HandlePong(payload)
+		}
+
+		if err != nil {
+			withConn(hw.server.logger, c).Error("handle control frame failed",
+				zaplogger.Error(err),
+				zaplogger.Event("control"),
+			)
+		}
+		return out
+	}
+
+	hw.server.metrics.receive(len(payload))
+
+	opCode, compressed, payload, ok := hw.joinFragment(c, header, payload)
+	if !ok {
+		return nil
+	}
+
+	var messageType ws.MessageType
+	switch opCode {
+	case ws.OpText:
+		messageType = ws.MessageText
+	case ws.OpBinary:
+		messageType = ws.MessageBinary
+	default:
+		return nil
+	}
+
+	if compressed {
+		var err error
+		if payload, err = inflate(c, payload, hw.server.limit.MaxMessageSize); err != nil {
+			if err == ErrMessageTooLarge {
+				tooBig(hw.server.logger, hw.server.metrics, c, err)
+				return nil
+			}
+
+			withConn(hw.server.logger, c).Error("decompress msg failed",
+				zaplogger.Error(err),
+				zaplogger.Event("message"),
+			)
+
+			closeWithStatus(c, ws.StatusProtocolError, err.Error())
+			return nil
+		}
+	}
+
+	messageType, out := hw.server.OnMessage(c, messageType, payload)
+	if len(out) < 1 {
+		return nil
+	}
+
+	data, err := util.PackData(messageType, out)
+	if err != nil {
+		withConn(hw.server.logger, c).Error("pack msg failed",
+			zaplogger.Error(err),
+			zapkey.Size(len(out)),
+		)
+		return nil
+	}
+	return data
+}
+
+// joinFragment 合并分帧消息，消息未结束时ok为false
+func (hw *handlerWrap) joinFragment(c *gev.Connection, header *ws.Header, payload []byte) (opCode ws.OpCode, compressed bool, data []byte, ok bool) {
+	value, exists := c.Get(fragmentKey)
+
+	if header.OpCode != ws.OpContinuation {
+		if exists && value != nil {
+			closeWithStatus(c, ws.StatusProtocolError, "unexpected data frame")
+			return
+		}
+
+		if header.Fin {
+			return header.OpCode, header.Rsv1(), payload, true
+		}
+
+		c.Set(fragmentKey, &fragment{
+			opCode:     header.OpCode,
+			compressed: header.Rsv1(),
+			data:       payload,
+		})
+		return
+	}
+
+	if !exists || value == nil {
+		closeWithStatus(c, ws.StatusProtocolError, "unexpected continuation frame")
+		return
+	}
+
+	f := value.(*fragment)
+	if err := hw.server.limit.checkMessage(len(f.data) + len(payload)); err != nil {
+		c.Set(fragmentKey, nil)
+		tooBig(hw.server.logger, hw.server.metrics, c, err)
+		return
+	}
+
+	f.data = append(f.data, payload...)
+	if !header.Fin {
+		return
+	}
+
+	c.Set(fragmentKey, nil)
+	return f.opCode, f.compressed, f.data, true
+}
+
+func inflate(c *gev.Connection, payload []byte, maxSize int) ([]byte, error) {
+	value, exists := c.Get(Compress)
+	if !exists {
+		return nil, ErrDeflateNotNegotiated
+	}
+
+	return value.(*deflater).decompress(payload, maxSize)
+}
+
+func (hw *handlerWrap) OnClose(c *gev.Connection) {
+	hw.server.OnClose(c)
+
+	if bts, ok := c.Get(headerBufferKey); ok {
+		pbytes.Put(bts.([]byte))
+	}
+}
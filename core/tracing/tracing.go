@@ -0,0 +1,212 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/grpc-boot/base"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ParamKey base.Package中保存trace context的param，值为traceparent、tracestate组成的map
+	ParamKey = "_trace"
+
+	ExporterStdout = "stdout"
+	ExporterOtlp   = "otlp"
+
+	tracerName = "event"
+)
+
+var (
+	ErrUnknownExporter = errors.New("tracing: unknown exporter")
+
+	propagator = propagation.TraceContext{}
+)
+
+// Option Exporter为空时不开启
+type Option struct {
+	Exporter string
+	// Endpoint otlp http地址，host:port，默认localhost:4318
+	Endpoint string
+	Insecure bool
+	// SampleRatio 采样比例，0到1，客户端传来的trace context同样按比例采样
+	SampleRatio float64
+	Service     string
+	Version     string
+	// Writer stdout exporter的输出，默认os.Stdout
+	Writer io.Writer
+}
+
+// Tracer 每个Server各自持有，nil表示未开启，方法可以直接调用
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// New Exporter为空时返回nil，不修改otel的全局TracerProvider
+func New(opt Option) (*Tracer, error) {
+	if opt.Exporter == "" {
+		return nil, nil
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch opt.Exporter {
+	case ExporterStdout:
+		writer := opt.Writer
+		if writer == nil {
+			writer = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer))
+	case ExporterOtlp:
+		opts := []otlptracehttp.Option{}
+		if opt.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(opt.Endpoint))
+		}
+		if opt.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, ErrUnknownExporter
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sampler(opt.SampleRatio)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(opt.Service),
+			semconv.ServiceVersionKey.String(opt.Version),
+		)),
+	)
+
+	return &Tracer{provider: provider, tracer: provider.Tracer(tracerName)}, nil
+}
+
+// sampler 客户端传来的父span不能决定是否采样，只有本地的父span沿用父span的采样结果
+func sampler(ratio float64) sdktrace.Sampler {
+	ratioBased := sdktrace.TraceIDRatioBased(ratio)
+	return sdktrace.ParentBased(ratioBased,
+		sdktrace.WithRemoteParentSampled(ratioBased),
+		sdktrace.WithRemoteParentNotSampled(ratioBased),
+	)
+}
+
+// Enabled 未开启时调用方跳过创建span和读写param
+func (t *Tracer) Enabled() bool {
+	return t != nil
+}
+
+// Start 创建span，start为零值时使用当前时间，未开启时返回不记录的span
+func (t *Tracer) Start(ctx context.Context, name string, start time.Time, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	opts := []trace.SpanStartOption{trace.WithSpanKind(kind), trace.WithAttributes(attrs...)}
+	if !start.IsZero() {
+		opts = append(opts, trace.WithTimestamp(start))
+	}
+	return t.tracer.Start(ctx, name, opts...)
+}
+
+// Shutdown 导出剩余的span
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// End err不为空时记录错误
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// paramCarrier 读写param[ParamKey]，json和msgpack解码后都是map[string]interface{}
+type paramCarrier struct {
+	param base.JsonParam
+}
+
+func (pc paramCarrier) values() map[string]interface{} {
+	switch values := pc.param[ParamKey].(type) {
+	case map[string]interface{}:
+		return values
+	case base.JsonParam:
+		return values
+	}
+	return nil
+}
+
+func (pc paramCarrier) Get(key string) string {
+	value, _ := pc.values()[key].(string)
+	return value
+}
+
+func (pc paramCarrier) Set(key string, value string) {
+	values := pc.values()
+	if values == nil {
+		values = make(map[string]interface{}, 2)
+		pc.param[ParamKey] = values
+	}
+	values[key] = value
+}
+
+func (pc paramCarrier) Keys() []string {
+	values := pc.values()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Extract 从param中读取上游的trace context
+func Extract(ctx context.Context, param base.JsonParam) context.Context {
+	if param == nil {
+		return ctx
+	}
+	return propagator.Extract(ctx, paramCarrier{param: param})
+}
+
+// Inject 把ctx中的trace context写入param，param为nil时创建
+func Inject(ctx context.Context, param base.JsonParam) base.JsonParam {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return param
+	}
+
+	if param == nil {
+		param = base.JsonParam{}
+	}
+
+	propagator.Inject(ctx, paramCarrier{param: param})
+	return param
+}
+
+// ExtractHeader 从握手请求的traceparent header读取trace context
+func ExtractHeader(ctx context.Context, header map[string][]string) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
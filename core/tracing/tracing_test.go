@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-boot/base"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(Option{Exporter: "zipkin"}); err != ErrUnknownExporter {
+		t.Fatalf("want ErrUnknownExporter, got %v", err)
+	}
+
+	disabled, err := New(Option{})
+	if err != nil || disabled.Enabled() {
+		t.Fatalf("want disabled, got %v %v", disabled, err)
+	}
+
+	var out bytes.Buffer
+	tracer, err := New(Option{Exporter: ExporterStdout, SampleRatio: 1, Service: "event", Writer: &out})
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if !tracer.Enabled() {
+		t.Fatalf("want enabled, got disabled")
+	}
+
+	ctx, span := tracer.Start(context.Background(), "client.send", time.Time{}, trace.SpanKindProducer)
+	param := Inject(ctx, nil)
+	span.End()
+
+	// 模拟经过json编码传给服务端
+	data, _ := json.Marshal(param)
+	var received base.JsonParam
+	_ = json.Unmarshal(data, &received)
+
+	_, child := tracer.Start(Extract(context.Background(), received), "event.message", time.Time{}, trace.SpanKindConsumer)
+	End(child, ErrUnknownExporter)
+
+	if got := child.SpanContext().TraceID(); got != span.SpanContext().TraceID() {
+		t.Fatalf("want %s, got %s", span.SpanContext().TraceID(), got)
+	}
+
+	// 未开启的Tracer不记录span
+	if _, noop := disabled.Start(ctx, "event.emit", time.Time{}, trace.SpanKindProducer); noop.IsRecording() {
+		t.Fatalf("want not recording, got recording")
+	}
+
+	if err = tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	for _, want := range []string{`"Name":"client.send"`, `"Name":"event.message"`, `"Code":"Error"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("want %s, got %s", want, out.String())
+		}
+	}
+}
+
+func TestInject(t *testing.T) {
+	param := base.JsonParam{"id": 1}
+	if got := Inject(context.Background(), param); len(got) != 1 {
+		t.Fatalf("want param unchanged, got %v", got)
+	}
+
+	if got := Extract(context.Background(), nil); trace.SpanContextFromContext(got).IsValid() {
+		t.Fatalf("want invalid span context, got valid")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	result := sampler(0).ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: trace.ContextWithRemoteSpanContext(context.Background(), parent),
+		TraceID:       parent.TraceID(),
+		Name:          "event.message",
+	})
+	if result.Decision != sdktrace.Drop {
+		t.Fatalf("want %v, got %v", sdktrace.Drop, result.Decision)
+	}
+}
@@ -0,0 +1,185 @@
+package zapkey
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/grpc-boot/base"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	Redacted = "******"
+)
+
+// Redactor 需要打码的param key，不区分大小写，嵌套的map和数组同样生效，可以在运行时更新，
+// 只对经过Core包装的日志生效
+type Redactor struct {
+	keys atomic.Value
+}
+
+func NewRedactor(keys []string) *Redactor {
+	r := &Redactor{}
+	r.SetKeys(keys)
+	return r
+}
+
+func (r *Redactor) SetKeys(keys []string) {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[strings.ToLower(key)] = struct{}{}
+	}
+	r.keys.Store(set)
+}
+
+func (r *Redactor) redacted(key string) bool {
+	if r == nil {
+		return false
+	}
+
+	_, exists := r.keys.Load().(map[string]struct{})[strings.ToLower(key)]
+	return exists
+}
+
+// Core 输出Param和Package字段时按r打码
+func (r *Redactor) Core(core zapcore.Core) zapcore.Core {
+	return redactCore{Core: core, redactor: r}
+}
+
+// fields 把r设置到Param和Package字段上，其他字段不变
+func (r *Redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for index, field := range fields {
+		var marshaler zapcore.ObjectMarshaler
+		switch value := field.Interface.(type) {
+		case pkgMarshaler:
+			value.redactor = r
+			marshaler = value
+		case paramMarshaler:
+			value.redactor = r
+			marshaler = value
+		default:
+			continue
+		}
+
+		if out == nil {
+			out = append(make([]zapcore.Field, 0, len(fields)), fields...)
+		}
+		out[index].Interface = marshaler
+	}
+
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+type redactCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (rc redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{Core: rc.Core.With(rc.redactor.fields(fields)), redactor: rc.redactor}
+}
+
+func (rc redactCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if rc.Enabled(entry.Level) {
+		return ce.AddCore(entry, rc)
+	}
+	return ce
+}
+
+func (rc redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return rc.Core.Write(entry, rc.redactor.fields(fields))
+}
+
+// Param 打码后的param，只在实际输出时编码
+func Param(param base.JsonParam) zap.Field {
+	return zap.Object("Param", paramMarshaler{param: param})
+}
+
+// Package 事件id、名称与打码后的param
+func Package(pkg *base.Package) zap.Field {
+	if pkg == nil {
+		return zap.Skip()
+	}
+	return zap.Object("Package", pkgMarshaler{pkg: pkg})
+}
+
+type pkgMarshaler struct {
+	pkg      *base.Package
+	redactor *Redactor
+}
+
+func (pm pkgMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddUint16("Id", pm.pkg.Id)
+	enc.AddString("Name", pm.pkg.Name)
+	return enc.AddObject("Param", paramMarshaler{param: pm.pkg.Param, redactor: pm.redactor})
+}
+
+type paramMarshaler struct {
+	param    map[string]interface{}
+	redactor *Redactor
+}
+
+func (pm paramMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	keys := make([]string, 0, len(pm.param))
+	for key := range pm.param {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if pm.redactor.redacted(key) {
+			enc.AddString(key, Redacted)
+			continue
+		}
+
+		var err error
+		switch value := pm.param[key].(type) {
+		case map[string]interface{}:
+			err = enc.AddObject(key, paramMarshaler{param: value, redactor: pm.redactor})
+		case base.JsonParam:
+			err = enc.AddObject(key, paramMarshaler{param: value, redactor: pm.redactor})
+		case []interface{}:
+			err = enc.AddArray(key, sliceMarshaler{slice: value, redactor: pm.redactor})
+		default:
+			err = enc.AddReflected(key, value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sliceMarshaler 数组中的map同样打码
+type sliceMarshaler struct {
+	slice    []interface{}
+	redactor *Redactor
+}
+
+func (sm sliceMarshaler) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, item := range sm.slice {
+		var err error
+		switch value := item.(type) {
+		case map[string]interface{}:
+			err = enc.AppendObject(paramMarshaler{param: value, redactor: sm.redactor})
+		case base.JsonParam:
+			err = enc.AppendObject(paramMarshaler{param: value, redactor: sm.redactor})
+		case []interface{}:
+			err = enc.AppendArray(sliceMarshaler{slice: value, redactor: sm.redactor})
+		default:
+			err = enc.AppendReflected(value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,3 +5,37 @@ import "go.uber.org/zap"
 func Address(addr string) zap.Field {
 	return zap.String("Address", addr)
 }
+
+func Reason(reason string) zap.Field {
+	return zap.String("Reason", reason)
+}
+
+func EventId(id uint16) zap.Field {
+	return zap.Uint16("EventId", id)
+}
+
+func ConnId(id uint64) zap.Field {
+	return zap.Uint64("ConnId", id)
+}
+
+func UserId(userId string) zap.Field {
+	return zap.String("UserId", userId)
+}
+
+// ProtocolLevel 握手时协商的协议级别，日志级别已经使用Level
+func ProtocolLevel(level uint8) zap.Field {
+	return zap.Uint8("ProtocolLevel", level)
+}
+
+func Room(room string) zap.Field {
+	return zap.String("Room", room)
+}
+
+func Rooms(rooms []string) zap.Field {
+	return zap.Strings("Rooms", rooms)
+}
+
+// Size 消息字节数，代替原始数据写入日志
+func Size(size int) zap.Field {
+	return zap.Int("Size", size)
+}
@@ -0,0 +1,52 @@
+package zapkey
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/grpc-boot/base"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func encode(r *Redactor, field zap.Field) string {
+	var out bytes.Buffer
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	logger := zap.New(r.Core(zapcore.NewCore(enc, zapcore.AddSync(&out), zapcore.DebugLevel)))
+
+	logger.Info("test", field)
+	return out.String()
+}
+
+func TestPackage(t *testing.T) {
+	r := NewRedactor([]string{"Password", "token"})
+
+	pkg := &base.Package{
+		Id:   0x0300,
+		Name: "login",
+		Param: base.JsonParam{
+			"user":     "u1",
+			"password": "p@ss",
+			"auth":     map[string]interface{}{"TOKEN": "t0ken", "ttl": 60},
+			"devices":  []interface{}{map[string]interface{}{"token": "d1"}, []interface{}{base.JsonParam{"password": "p2"}}, "ios"},
+		},
+	}
+
+	want := `{"msg":"test","Package":{"Id":768,"Name":"login","Param":{"auth":{"TOKEN":"******","ttl":60},"devices":[{"token":"******"},[{"password":"******"}],"ios"],"password":"******","user":"u1"}}}` + "\n"
+	if got := encode(r, Package(pkg)); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	r.SetKeys(nil)
+	want = `{"msg":"test","Param":{"password":"p@ss"}}` + "\n"
+	if got := encode(r, Param(base.JsonParam{"password": "p@ss"})); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	// 不同Redactor互不影响
+	other := NewRedactor([]string{"password"})
+	want = `{"msg":"test","Param":{"password":"******"}}` + "\n"
+	if got := encode(other, Param(base.JsonParam{"password": "p@ss"})); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+}
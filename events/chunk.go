@@ -0,0 +1,18 @@
+package events
+
+import (
+	"event/core/server"
+
+	"github.com/grpc-boot/base/core/zaplogger"
+	"go.uber.org/zap"
+)
+
+func ChunkProgress(conn *server.Conn, transferId string, eventId uint16, done, size int) {
+	conn.Logger().Debug("chunk progress",
+		zaplogger.Event("chunk"),
+		zap.String("TransferId", transferId),
+		zap.Uint16("EventId", eventId),
+		zap.Int("Done", done),
+		zap.Int("Size", size),
+	)
+}
@@ -0,0 +1,20 @@
+// Code generated by eventgen. DO NOT EDIT.
+
+package events
+
+const (
+	// 协议相关
+	EventConnectSuccess = 0x0100
+	EventTick           = 0x0101
+	EventClose          = 0x0102
+	EventError          = 0x0103
+	EventChunk          = 0x0104 // 分片包，与chunk.EventChunk一致
+
+	// 登录相关
+	EventLogin        = 0x0200
+	EventLoginSuccess = 0x0201
+	EventLoginFailed  = 0x0202
+
+	// 消息相关
+	EventMessage = 0x0300
+)
@@ -0,0 +1,13 @@
+package events
+
+import (
+	"testing"
+
+	"event/core/chunk"
+)
+
+func TestEventChunk(t *testing.T) {
+	if EventChunk != chunk.EventChunk {
+		t.Fatalf("want 0x%04x, got 0x%04x", chunk.EventChunk, EventChunk)
+	}
+}
@@ -1,21 +1,96 @@
 package events
 
+//go:generate go run ../cmd/eventgen -in events.json -go event.go -pkg events -js ../web/event.js
+
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"event/components"
 	"event/components/router"
+	"event/core/chunk"
+	"event/core/ratelimit"
 
 	"github.com/grpc-boot/base"
 )
 
-const (
-	EventMessage = 0x0300
-)
-
-func LoadRouter() *router.Route {
+func LoadRouter(app *components.App) (*router.Route, error) {
 	r := router.NewRouter()
 
-	r.On(base.EventClose, Close)
-	r.On(base.EventConnectSuccess, Connect)
+	conf := app.Config()
+	r.WithChunk(chunk.Option{
+		ChunkSize:    conf.Params.Int("chunk.size"),
+		MaxSize:      conf.Params.Int("chunk.maxSize"),
+		MaxTransfers: conf.Params.Int("chunk.maxTransfers"),
+		Timeout:      time.Second * time.Duration(conf.Params.Int64("chunk.timeoutSeconds")),
+	}, ChunkProgress)
+
+	limitOpt, err := rateLimitOption(conf.Params)
+	if err != nil {
+		return nil, err
+	}
+	r.WithRateLimit(limitOpt)
+
+	// 已建立的连接在下一条消息时按新配置重建限流器
+	app.OnReload(func(c *base.Config) error {
+		opt, err := rateLimitOption(c.Params)
+		if err != nil {
+			return err
+		}
+
+		r.WithRateLimit(opt)
+		return nil
+	}, "rate.")
+
+	r.On(EventClose, Close)
+	r.On(EventConnectSuccess, Connect)
 	r.On(EventMessage, Message)
 
-	return r
+	return r, nil
+}
+
+func rateLimitOption(params base.JsonParam) (opt ratelimit.Option, err error) {
+	events, err := loadEventLimits(params)
+	if err != nil {
+		return opt, err
+	}
+
+	return ratelimit.Option{
+		Rate:          params.Float64("rate.limit"),
+		Burst:         params.Int("rate.burst"),
+		Events:        events,
+		Penalty:       ratelimit.Penalty(params.String("rate.penalty")),
+		MaxViolations: params.Int("rate.maxViolations"),
+		MaxDelay:      time.Millisecond * time.Duration(params.Int64("rate.maxDelayMs")),
+	}, nil
+}
+
+// loadEventLimits rate.events的key为事件id，支持0x前缀
+func loadEventLimits(params base.JsonParam) (map[uint16]ratelimit.EventLimit, error) {
+	value, exists := params["rate.events"]
+	if !exists {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var limits map[string]ratelimit.EventLimit
+	if err = json.Unmarshal(data, &limits); err != nil {
+		return nil, err
+	}
+
+	events := make(map[uint16]ratelimit.EventLimit, len(limits))
+	for key, limit := range limits {
+		id, err := strconv.ParseUint(key, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event id %s in rate.events", key)
+		}
+		events[uint16(id)] = limit
+	}
+	return events, nil
 }
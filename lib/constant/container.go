@@ -1,6 +0,0 @@
-package constant
-
-const (
-	Aes    = `c:aes`
-	Accept = `c:accept`
-)
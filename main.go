@@ -1,143 +1,87 @@
 package main
 
 import (
-	"context"
-	"event/events"
-	"net/url"
+	"flag"
 	"os"
 	"os/signal"
-	"strconv"
+	"strings"
 	"syscall"
-	"time"
 
 	"event/components"
-	"event/core/server"
-	"event/lib/constant"
+	"event/core/config"
+	"event/events"
 
-	"github.com/Allenxuxu/gev"
-	"github.com/Allenxuxu/gev/plugins/websocket/ws"
-	"github.com/Allenxuxu/gev/plugins/websocket/ws/util"
 	"github.com/grpc-boot/base"
 	"github.com/grpc-boot/base/core/zaplogger"
 	"go.uber.org/zap"
 )
 
-func init() {
-	var c = &base.Config{}
-	err := base.JsonDecodeFile("./conf/app.json", c)
-	if err != nil {
-		base.RedFatal("read conf file error:%s", err)
-	}
-
-	base.Green("run with config:%+v", *c)
+// overrides 可重复的-set key=value
+type overrides []string
 
-	base.DefaultContainer.SetConfig(c)
-
-	err = base.InitZapWithOption(c.Logger)
-	if err != nil {
-		base.RedFatal("init logger error:%s", err)
-	}
+func (o *overrides) String() string {
+	return strings.Join(*o, ",")
+}
 
-	components.Bootstrap()
+func (o *overrides) Set(value string) error {
+	*o = append(*o, value)
+	return nil
 }
 
 func main() {
-	var (
-		err error
-	)
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdmin(os.Args[2:], os.Stdout, os.Stderr))
+	}
 
 	var (
-		conf      = base.DefaultContainer.Config()
-		accept, _ = base.DefaultContainer.Get(constant.Accept)
+		opt   config.Option
+		check bool
+		set   overrides
 	)
 
-	wsUpgrader := &ws.Upgrader{}
-	wsUpgrader.OnRequest = func(c *gev.Connection, uri []byte) error {
-		urlInfo, err := url.ParseRequestURI(base.Bytes2String(uri))
-		if err != nil {
-			return ws.ErrHandshakeBadUpgrade
-		}
-
-		l, _ := strconv.Atoi(urlInfo.Query().Get("l"))
-		key := urlInfo.Query().Get("k")
-		level := uint8(l)
-
-		base.Green("level:%d", level)
-
-		protocol, err := accept.(*base.Accept).AcceptHex(level, []byte(key))
-		if err != nil {
-			return ws.ErrHandshakeBadUpgrade
-		}
-
-		if level > base.LevelV1 {
-			pkg := &base.Package{
-				Id:   base.EventConnectSuccess,
-				Name: "connect success",
-				Param: base.JsonParam{
-					"data": nil,
-				},
-			}
-
-			k := protocol.ResponseKey()
-			if len(k) > 0 {
-				pkg.Param["data"] = k
-			}
-
-			text := pkg.Pack()
-			msg, err := util.PackData(ws.MessageText, text)
-			if err != nil {
-				base.ZapError("pack text msg failed",
-					zaplogger.Error(err),
-					zaplogger.Value(text),
-				)
-				return ws.ErrHandshakeBadUpgrade
-			}
+	flag.StringVar(&opt.File, "config", config.DefaultFile, "config file")
+	flag.StringVar(&opt.Profile, "profile", "", "profile, merges app.<profile>.json over the config file, default EVENT_PROFILE or env")
+	flag.Var(&set, "set", "override a config key, key=value, repeatable")
+	flag.BoolVar(&check, "check", false, "validate config and exit")
+	flag.Parse()
 
-			if err = c.Send(msg); err != nil {
-				base.ZapError("send connect success failed",
-					zaplogger.Error(err),
-					zaplogger.Value(text),
-				)
-				return ws.ErrHandshakeBadUpgrade
-			}
-		}
+	opt.Overrides = set
+	app, err := components.NewApp(opt, events.LoadRouter)
+	if err != nil {
+		base.RedFatal("read conf file error:%s", err)
+	}
 
-		c.Set(server.Protocol, protocol)
-		return nil
+	if check {
+		base.Green("config ok:%+v", app.Redacted())
+		os.Exit(0)
 	}
 
-	s := server.NewServer()
-	s.WithHandler(events.LoadRouter())
+	base.Green("run with config:%+v", app.Redacted())
 
-	go handlerSignal(s, conf)
+	if err = app.Init(); err != nil {
+		base.RedFatal("init failed:%s", err)
+	}
 
-	err = s.Serve(wsUpgrader,
-		gev.Network("tcp"),
-		gev.Address(conf.Addr),
-		gev.NumLoops(conf.Params.Int("numLoops")),
-		gev.ReusePort(false),
-		gev.IdleTime(time.Second*time.Duration(conf.Params.Int64("maxIdleSeconds"))),
-	)
-	if err != nil {
-		base.Fatal("new server failed",
-			zaplogger.Error(err),
-		)
+	if err = app.Start(); err != nil {
+		base.RedFatal("start failed:%s", err)
 	}
+
+	handlerSignal(app)
 }
 
-func handlerSignal(s *server.Server, conf *base.Config) {
+func handlerSignal(app *components.App) {
 	defer func() {
 		if er := recover(); er != nil {
-			base.ZapError("recover msg",
+			app.Logger.Error("recover msg",
 				zaplogger.Error(er.(error)),
 				zaplogger.Event("recover"),
 			)
 		}
 
-		base.ZapInfo("shutdown")
+		app.Logger.Info("shutdown")
 
-		if err := s.Shutdown(time.Second * 10); err != nil {
-			base.ZapError("shutdown failed",
+		if err := app.Stop(); err != nil {
+			app.Logger.Error("shutdown failed",
 				zaplogger.Event("shutdown"),
 				zaplogger.Error(err),
 			)
@@ -145,43 +89,21 @@ func handlerSignal(s *server.Server, conf *base.Config) {
 	}()
 
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(signalCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 	for {
 		sig := <-signalCh
-		base.ZapInfo("signal",
+		app.Logger.Info("signal",
 			zap.String("Signal", sig.String()),
 		)
 
 		switch sig {
-		case syscall.SIGUSR1:
-			if conf.PprofAddr == "" {
-				continue
-			}
-
-			go func() {
-				if err := base.StartPprof(conf.PprofAddr, nil); err != nil {
-					base.ZapError("start pprof failed",
-						zaplogger.Event("pprof start"),
-						zaplogger.Error(err),
-					)
-				}
-			}()
-			continue
-		case syscall.SIGUSR2:
-			if conf.PprofAddr == "" {
-				continue
+		case syscall.SIGHUP:
+			if _, err := app.Reload(); err != nil {
+				app.Logger.Error("reload config failed",
+					zaplogger.Event("reload"),
+					zaplogger.Error(err),
+				)
 			}
-
-			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-				defer cancel()
-				if err := base.StopPprof(ctx); err != nil {
-					base.ZapError("stop pprof failed",
-						zaplogger.Event("pprof stop"),
-						zaplogger.Error(err),
-					)
-				}
-			}()
 			continue
 		default:
 			return
@@ -0,0 +1,16 @@
+// Code generated by eventgen. DO NOT EDIT.
+
+// 协议相关
+const EventConnectSuccess = 0x0100;
+const EventTick = 0x0101;
+const EventClose = 0x0102;
+const EventError = 0x0103;
+const EventChunk = 0x0104; // 分片包，与chunk.EventChunk一致
+
+// 登录相关
+const EventLogin = 0x0200;
+const EventLoginSuccess = 0x0201;
+const EventLoginFailed = 0x0202;
+
+// 消息相关
+const EventMessage = 0x0300;
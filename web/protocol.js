@@ -2,19 +2,8 @@ const LevelJson = 0;
 const LevelV0   = LevelJson;
 const LevelV1   = 1;
 const LevelV2   = 2;
-
-//协议相关
-const EventConnectSuccess = 0x0100;
-const EventTick           = 0x0101;
-const EventClose          = 0x0102;
-const EventError          = 0x0103;
-
-// 登录相关
-const EventLogin               = 0x0200;
-const EventLoginSuccess        = 0x0201;
-const EventLoginFailed         = 0x0202;
-
-const EventMessage = 0x0300;
+const LevelAead = 6;
+const LevelEcdh = 7;
 
 function encrypt(msg, k, v) {
     return CryptoJS.AES.encrypt(CryptoJS.enc.Utf8.parse(msg),
@@ -32,6 +21,14 @@ function decrypt(base64Data, k, v) {
     );
 }
 
+function randSecret() {
+    let data = new Uint8Array(16);
+    crypto.getRandomValues(data);
+    return Array.from(data, function (b) {
+        return ('0' + b.toString(16)).slice(-2);
+    }).join('');
+}
+
 function randKey() {
     return Math.ceil(0x1000000000000000 + Math.random() * 0xf000000000000000).toString(16);
 }
@@ -80,15 +77,18 @@ Package.prototype.unpack = function (data) {
     return true;
 }
 
-function WsProtocol(uri, level, k, v) {
+function WsProtocol(uri, level, k, v, kid) {
     this.uri      = uri;
     this.level    = level;
     this.k        = k;
     this.v        = v;
+    this.kid      = kid || '';
     this.ws       = null;
     this.protocol = null;
     this.events   = {};
     this.retryIng = false;
+    this.sendQueue = Promise.resolve();
+    this.recvQueue = Promise.resolve();
 }
 
 WsProtocol.prototype.buildUri = function () {
@@ -101,6 +101,9 @@ WsProtocol.prototype.buildUri = function () {
     }
 
     url+= ('l='+this.level);
+    if(this.kid && this.level !== LevelJson) {
+        url+= ('&kid='+encodeURIComponent(this.kid));
+    }
     let key = randKey();
 
     switch (this.level) {
@@ -116,20 +119,48 @@ WsProtocol.prototype.buildUri = function () {
             this.protocol = new V2(key, this.k + this.v);
             url+= ('&k='+encrypt(key, this.k, this.v).ciphertext.toString());
             break;
+        case LevelAead:
+            key = randSecret();
+            this.protocol = new Aead(key, this.k + this.v);
+            url+= ('&k='+encrypt(key, this.k, this.v).ciphertext.toString());
+            break;
+        case LevelEcdh:
+            // k为服务端签名公钥的hex，生成临时密钥对是异步的
+            this.protocol = new Ecdh(this.k);
+            return this.protocol.generate().then(function (publicKey) {
+                return url + '&k=' + publicKey;
+            });
     }
 
     return url;
 }
 
 WsProtocol.prototype.dial = function () {
-    let url = this.buildUri();
-    this.ws = new WebSocket(url);
+    let self = this;
+    Promise.resolve(this.buildUri()).then(function (url) {
+        self.ws = new WebSocket(url);
+        self.initEvent();
+    }).catch(function (e) {
+        console.log('dial failed', e);
+    });
 
-    this.initEvent();
     this.healthCheck(30*1000);
 }
 
 WsProtocol.prototype.emit = function (pkg) {
+    if(this.protocol.async) {
+        // webcrypto是异步的，按调用顺序加密发送，保证序号递增
+        let self = this, protocol = this.protocol;
+        this.sendQueue = this.sendQueue.then(function () {
+            return protocol.pack(pkg);
+        }).then(function (msg) {
+            self.ws.send(msg);
+        }).catch(function (e) {
+            console.log(e);
+        });
+        return;
+    }
+
     try {
         let msg = this.protocol.pack(pkg);
         this.ws.send(msg);
@@ -159,6 +190,22 @@ WsProtocol.prototype.initEvent = function () {
             return;
         }
 
+        if(self.protocol.async) {
+            let protocol = self.protocol;
+            self.recvQueue = self.recvQueue.then(function () {
+                return protocol.unpack(event.data);
+            }).then(function (pkg) {
+                if(!pkg) {
+                    console.log('unpack failed', event);
+                    return;
+                }
+                self.trigger(pkg.id, pkg);
+            }).catch(function (e) {
+                console.log('unpack failed', e);
+            });
+            return;
+        }
+
         let pkg = self.protocol.unpack(event.data);
         if(!pkg) {
             console.log('unpack failed', event);
@@ -345,4 +392,185 @@ V2.prototype.unpack = function (data) {
         return pkg;
     }
     return false;
-}
\ No newline at end of file
+}
+
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder();
+
+function aeadNonce(seq) {
+    let nonce = new Uint8Array(12);
+    let view  = new DataView(nonce.buffer);
+    view.setUint32(4, Math.floor(seq / 0x100000000));
+    view.setUint32(8, seq >>> 0);
+    return nonce;
+}
+
+function bytes2Base64(bytes) {
+    let str = '';
+    for(let i = 0; i < bytes.length; i++) {
+        str += String.fromCharCode(bytes[i]);
+    }
+    return btoa(str);
+}
+
+function base642Bytes(data) {
+    let str = atob(data);
+    let bytes = new Uint8Array(str.length);
+    for(let i = 0; i < str.length; i++) {
+        bytes[i] = str.charCodeAt(i);
+    }
+    return bytes;
+}
+
+// Aead AES-256-GCM，收发密钥由secret和服务端下发的salt经HKDF派生，需要https或localhost
+function Aead(secret, key) {
+    this.secret  = secret;
+    this.key     = key;
+    this.level   = LevelAead;
+    this.async   = true;
+    this.headerLength = 32;
+    this.startTag = '063a';
+    this.sealer  = null;
+    this.opener  = null;
+    this.sendSeq = 0;
+    this.recvSeq = 0;
+}
+
+Aead.prototype.derive = async function (secret, salt) {
+    let ikm = await crypto.subtle.importKey('raw', secret, 'HKDF', false, ['deriveKey']);
+    let derive = function (info) {
+        return crypto.subtle.deriveKey({
+            name: 'HKDF',
+            hash: 'SHA-256',
+            salt: salt,
+            info: textEncoder.encode(info)
+        }, ikm, {name: 'AES-GCM', length: 256}, false, ['encrypt', 'decrypt']);
+    };
+
+    this.sealer = await derive('event aead client');
+    this.opener = await derive('event aead server');
+}
+
+// accept 收到connect success后解密salt并派生密钥
+Aead.prototype.accept = async function (data) {
+    let salt = decrypt(data, this.key.substring(0, 16), this.key.substring(16));
+    await this.derive(textEncoder.encode(this.secret), textEncoder.encode(salt.toString(CryptoJS.enc.Utf8)));
+}
+
+Aead.prototype.pack = async function (pkg) {
+    let seq    = ++this.sendSeq;
+    let header = this.startTag + int2HexWithPad(pkg.id, 4) + int2HexWithPad(seq, 16);
+    let body   = await crypto.subtle.encrypt({
+        name: 'AES-GCM',
+        iv: aeadNonce(seq),
+        additionalData: textEncoder.encode(header)
+    }, this.sealer, textEncoder.encode(pkg.pack()));
+
+    let data = bytes2Base64(new Uint8Array(body));
+    return header + int2HexWithPad(data.length, 8) + data;
+}
+
+Aead.prototype.unpack = async function (data) {
+    if (!data || data.length < this.headerLength + 1) {
+        return false;
+    }
+
+    if (data.substring(0, 4) !== this.startTag) {
+        if(this.opener === null && data.substring(0, 1) === '{') {
+            let pkg = new Package();
+            if(pkg.unpack(data) && pkg.id === EventConnectSuccess && pkg.param['data']) {
+                await this.accept(pkg.param['data']);
+                return pkg;
+            }
+        }
+        return false;
+    }
+
+    let id = parseInt(data.substring(4, 8), 16);
+    if(id < 1 || id > 0xffff) {
+        return false;
+    }
+
+    // 重放或乱序的包直接丢弃
+    let seq = parseInt(data.substring(8, 24), 16);
+    if(!(seq > this.recvSeq)) {
+        return false;
+    }
+
+    let bodyLength = parseInt(data.substring(24, this.headerLength), 16);
+    if(bodyLength + this.headerLength !== data.length) {
+        return false;
+    }
+
+    let plain = await crypto.subtle.decrypt({
+        name: 'AES-GCM',
+        iv: aeadNonce(seq),
+        additionalData: textEncoder.encode(data.substring(0, 24))
+    }, this.opener, base642Bytes(data.substring(this.headerLength)));
+
+    let pkg = new Package();
+    if(!pkg.unpack(textDecoder.decode(plain)) || pkg.id !== id) {
+        return false;
+    }
+
+    this.recvSeq = seq;
+    return pkg;
+}
+
+function hex2Bytes(hex) {
+    let bytes = new Uint8Array(hex.length / 2);
+    for(let i = 0; i < bytes.length; i++) {
+        bytes[i] = parseInt(hex.substring(i * 2, i * 2 + 2), 16);
+    }
+    return bytes;
+}
+
+function concatBytes() {
+    let length = 0;
+    for(let i = 0; i < arguments.length; i++) {
+        length += arguments[i].length;
+    }
+
+    let bytes = new Uint8Array(length), offset = 0;
+    for(let i = 0; i < arguments.length; i++) {
+        bytes.set(arguments[i], offset);
+        offset += arguments[i].length;
+    }
+    return bytes;
+}
+
+// Ecdh X25519交换会话密钥，只需要服务端签名公钥，浏览器需支持webcrypto的X25519与Ed25519
+function Ecdh(serverKey) {
+    Aead.call(this, '', '');
+    this.serverKey = serverKey;
+    this.level     = LevelEcdh;
+    this.keyPair   = null;
+    this.publicKey = null;
+}
+
+Ecdh.prototype = Object.create(Aead.prototype);
+Ecdh.prototype.constructor = Ecdh;
+
+Ecdh.prototype.generate = async function () {
+    this.keyPair   = await crypto.subtle.generateKey({name: 'X25519'}, false, ['deriveBits']);
+    this.publicKey = new Uint8Array(await crypto.subtle.exportKey('raw', this.keyPair.publicKey));
+    return Array.from(this.publicKey, function (b) {
+        return ('0' + b.toString(16)).slice(-2);
+    }).join('');
+}
+
+Ecdh.prototype.accept = async function (data) {
+    let response     = base642Bytes(data);
+    let serverPublic = response.slice(0, 32);
+
+    let verifyKey = await crypto.subtle.importKey('raw', hex2Bytes(this.serverKey), {name: 'Ed25519'}, false, ['verify']);
+    let valid = await crypto.subtle.verify({name: 'Ed25519'}, verifyKey, response.slice(32),
+        concatBytes(textEncoder.encode('event ecdh'), this.publicKey, serverPublic));
+    if(!valid) {
+        throw new Error('invalid server signature');
+    }
+
+    let peer   = await crypto.subtle.importKey('raw', serverPublic, {name: 'X25519'}, false, []);
+    let shared = await crypto.subtle.deriveBits({name: 'X25519', public: peer}, this.keyPair.privateKey, 256);
+    await this.derive(new Uint8Array(shared), concatBytes(this.publicKey, serverPublic));
+}